@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// isArchiveLayer reports whether a layer of mediaType is a tar archive,
+// optionally gzip compressed, e.g. application/vnd.oci.image.layer.v1.tar+gzip
+// or application/vnd.docker.image.rootfs.diff.tar.gzip.
+func isArchiveLayer(mediaType string) bool {
+	base, _, _ := strings.Cut(mediaType, "+")
+	return strings.HasSuffix(base, ".tar") || strings.HasSuffix(base, ".tar.gzip") || base == "application/x-tar"
+}
+
+// checkArchiveCompression rejects archive layers compressed with anything
+// but gzip, which extractTar cannot read.
+func checkArchiveCompression(mediaType string) error {
+	if !strings.HasSuffix(mediaType, "tar") && !strings.HasSuffix(mediaType, "gzip") {
+		return fmt.Errorf("unsupported archive compression: %s", mediaType)
+	}
+	return nil
+}
+
+// orasUnpackArchives returns an oras.CopyGraph PostCopy hook that unpacks
+// the titled archive layers the file store wrote to destDir, like
+// processArchiveLayer does for go-containerregistry pulls, and removes the
+// archive files. The unpacked content counts against limits.
+func orasUnpackArchives(destDir string, limits *pullLimits) func(ctx context.Context, desc ocispec.Descriptor) error {
+	names := newLayerNames()
+	return func(ctx context.Context, desc ocispec.Descriptor) error {
+		title := desc.Annotations[ocispec.AnnotationTitle]
+		if title == "" || !isArchiveLayer(desc.MediaType) {
+			return nil
+		}
+		if err := checkArchiveCompression(desc.MediaType); err != nil {
+			return err
+		}
+
+		// Reserve the archive's own name so a title without an archive
+		// extension is not unpacked onto the archive file
+		names.claim(sanitizeTitle(title), "")
+		archive := filepath.Join(destDir, title)
+		dir := filepath.Join(destDir, names.dir(title, 0))
+
+		before := limits.files
+		if err := extractArchive(archive, dir, limits); err != nil {
+			return fmt.Errorf("extracting %s: %w", title, err)
+		}
+		if err := os.Remove(archive); err != nil {
+			return fmt.Errorf("removing %s: %w", title, err)
+		}
+
+		log.Printf("  Extracted %d file(s) to: %s/\n", limits.files-before, filepath.Base(dir))
+		return nil
+	}
+}
+
+// extractArchive unpacks a tar or tar.gz archive into dir. Only regular files
+// and directories are extracted, and entries escaping dir are rejected. With
+// limits set the archive counts against the pull limits.
+func extractArchive(archive, dir string, limits *pullLimits) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v", archive, err)
+		}
+	}()
+
+	return extractTar(f, dir, limits)
+}
+
+// extractTar unpacks a tar stream, gunzipping it when compressed, into dir.
+// Only regular files and directories are extracted: symlinks, hard links and
+// device files are skipped so nothing outside dir can be written or read
+// through them, and entries escaping dir are rejected. With limits set the
+// uncompressed stream and every file count against the pull limits.
+func extractTar(r io.Reader, dir string, limits *pullLimits) error {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := gz.Close(); err != nil {
+				log.Printf("Warning: failed to close gzip reader: %v", err)
+			}
+		}()
+		src = gz
+	}
+	if limits != nil {
+		src = limits.layerReader(filepath.Base(dir), src)
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			if filepath.Clean(hdr.Name) == "." {
+				continue
+			}
+			return fmt.Errorf("archive entry %q escapes the extraction directory", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if limits != nil {
+				if err := limits.addFile(hdr.Name); err != nil {
+					return err
+				}
+			}
+			if err := writeArchiveFile(target, tr); err != nil {
+				return err
+			}
+		default:
+			log.Printf("Warning: skipping archive entry %s of type %c\n", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+func writeArchiveFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// newTarLayerImage builds an artifact with a single archive layer holding
+// headers, gzip compressed for tar+gzip media types.
+func newTarLayerImage(t *testing.T, mediaType types.MediaType, headers []*tar.Header, contents map[string]string) v1.Image {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range headers {
+		content := contents[hdr.Name]
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader() error = %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data := buf.Bytes()
+	if strings.HasSuffix(string(mediaType), "gzip") {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		if _, err := zw.Write(data); err != nil {
+			t.Fatalf("gzip Write() error = %v", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("gzip Close() error = %v", err)
+		}
+		data = gz.Bytes()
+	}
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{Layer: static.NewLayer(data, mediaType)})
+	if err != nil {
+		t.Fatalf("building image: %v", err)
+	}
+	return img
+}
+
+// policyArchive returns the entries of a policy bundle: two policies next to
+// a symlink, a hard link and a device file that must not be extracted.
+func policyArchive() ([]*tar.Header, map[string]string) {
+	headers := []*tar.Header{
+		{Name: "policies/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "policies/require-labels.yaml", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "policies/team/disallow-latest.yaml", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "policies/passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		{Name: "policies/hosts", Typeflag: tar.TypeLink, Linkname: "/etc/hosts"},
+		{Name: "policies/null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3},
+	}
+	contents := map[string]string{
+		"policies/require-labels.yaml":       testPolicyYAML,
+		"policies/team/disallow-latest.yaml": strings.Replace(testPolicyYAML, "require-labels", "disallow-latest", 1),
+	}
+	return headers, contents
+}
+
+// checkPolicyArchive verifies that the policyArchive bundle was unpacked
+// into dir and nothing else was written.
+func checkPolicyArchive(t *testing.T, outputDir, dir string) {
+	t.Helper()
+	_, contents := policyArchive()
+	for name, want := range contents {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+		if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0644 {
+			t.Errorf("%s mode = %v, want 0644", name, info.Mode().Perm())
+		}
+	}
+	for _, name := range []string{"passwd", "hosts", "null"} {
+		if _, err := os.Lstat(filepath.Join(dir, "policies", name)); !os.IsNotExist(err) {
+			t.Errorf("%s was extracted: %v", name, err)
+		}
+	}
+
+	files, err := findYAMLFiles(outputDir)
+	if err != nil {
+		t.Fatalf("findYAMLFiles() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("findYAMLFiles() = %v, want both policies for the apply step", files)
+	}
+}
+
+func TestExtractImageArchiveLayers(t *testing.T) {
+	for _, mediaType := range []types.MediaType{types.OCILayer, types.OCIUncompressedLayer, types.DockerLayer} {
+		t.Run(string(mediaType), func(t *testing.T) {
+			dir := t.TempDir()
+			headers, contents := policyArchive()
+			if err := extractImage(&Config{}, newTarLayerImage(t, mediaType, headers, contents), dir); err != nil {
+				t.Fatalf("extractImage() error = %v", err)
+			}
+			checkPolicyArchive(t, dir, filepath.Join(dir, "layer-0"))
+		})
+	}
+}
+
+func TestOrasPullArchiveLayers(t *testing.T) {
+	host := newTestRegistry(t)
+	config := &Config{
+		Provider:           "oci",
+		ImageBase:          host + "/team/policies",
+		InsecureRegistries: []string{host},
+	}
+
+	for _, mediaType := range []types.MediaType{types.OCILayer, types.OCIUncompressedLayer, types.DockerLayer} {
+		t.Run(string(mediaType), func(t *testing.T) {
+			// The file store only writes titled layers, as oras push records
+			headers, contents := policyArchive()
+			layers, err := newTarLayerImage(t, mediaType, headers, contents).Layers()
+			if err != nil {
+				t.Fatalf("Layers() error = %v", err)
+			}
+			img, err := mutate.Append(empty.Image, mutate.Addendum{
+				Layer:       layers[0],
+				Annotations: map[string]string{ocispec.AnnotationTitle: "bundle.tar.gz"},
+			})
+			if err != nil {
+				t.Fatalf("building image: %v", err)
+			}
+			ref := config.ImageBase + ":" + strings.NewReplacer("/", "-", ".", "-", "+", "-").Replace(string(mediaType))
+			pushPolicyImage(t, ref, img)
+
+			dir := filepath.Join(t.TempDir(), "image")
+			if err := orasPull(context.Background(), config, ref, dir); err != nil {
+				t.Fatalf("orasPull() error = %v", err)
+			}
+			checkPolicyArchive(t, dir, filepath.Join(dir, "bundle"))
+			if _, err := os.Stat(filepath.Join(dir, "bundle.tar.gz")); !os.IsNotExist(err) {
+				t.Errorf("archive was left next to the unpacked policies: %v", err)
+			}
+
+			err = orasPull(context.Background(), &Config{
+				Provider:           "oci",
+				ImageBase:          config.ImageBase,
+				InsecureRegistries: []string{host},
+				MaxFiles:           1,
+			}, ref, filepath.Join(t.TempDir(), "image"))
+			if !errors.Is(err, errPullLimit) || !strings.Contains(err.Error(), "MAX_FILES") {
+				t.Errorf("orasPull() error = %v, want a MAX_FILES pull limit error", err)
+			}
+		})
+	}
+}
+
+func TestExtractImageArchiveLayerRejectsTraversal(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "image")
+	headers := []*tar.Header{{Name: "../../evil.yaml", Typeflag: tar.TypeReg, Mode: 0644}}
+	img := newTarLayerImage(t, types.OCILayer, headers, map[string]string{"../../evil.yaml": "owned"})
+
+	err := extractImage(&Config{}, img, dir)
+	if err == nil || !strings.Contains(err.Error(), "escapes the extraction directory") {
+		t.Errorf("extractImage() error = %v, want traversal error", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "evil.yaml")); !os.IsNotExist(err) {
+		t.Errorf("file outside the extraction directory was written: %v", err)
+	}
+}
+
+func TestExtractImageArchiveLayerLimits(t *testing.T) {
+	var headers []*tar.Header
+	contents := map[string]string{}
+	for _, name := range []string{"a.yaml", "b.yaml", "c.yaml"} {
+		headers = append(headers, &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644})
+		contents[name] = testPolicyYAML
+	}
+	img := newTarLayerImage(t, types.OCILayer, headers, contents)
+
+	err := extractImage(&Config{MaxFiles: 2}, img, t.TempDir())
+	if !errors.Is(err, errPullLimit) || !strings.Contains(err.Error(), "MAX_FILES") {
+		t.Errorf("extractImage() error = %v, want a MAX_FILES pull limit error", err)
+	}
+
+	// The uncompressed size counts, so a small gzip cannot expand unbounded
+	big := map[string]string{"big.yaml": strings.Repeat("#", 1<<20)}
+	img = newTarLayerImage(t, types.OCILayer, []*tar.Header{{Name: "big.yaml", Typeflag: tar.TypeReg, Mode: 0644}}, big)
+	err = extractImage(&Config{MaxLayerSize: 64 << 10}, img, t.TempDir())
+	if !errors.Is(err, errPullLimit) || !strings.Contains(err.Error(), "MAX_LAYER_SIZE") {
+		t.Errorf("extractImage() error = %v, want a MAX_LAYER_SIZE pull limit error", err)
+	}
+}
+
+func TestIsArchiveLayer(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		want      bool
+	}{
+		{mediaType: "application/vnd.oci.image.layer.v1.tar", want: true},
+		{mediaType: "application/vnd.oci.image.layer.v1.tar+gzip", want: true},
+		{mediaType: "application/vnd.oci.image.layer.v1.tar+zstd", want: true},
+		{mediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", want: true},
+		{mediaType: "application/x-tar", want: true},
+		{mediaType: PolicyLayerMediaType, want: false},
+		{mediaType: "application/yaml", want: false},
+	}
+	for _, tt := range tests {
+		if got := isArchiveLayer(tt.mediaType); got != tt.want {
+			t.Errorf("isArchiveLayer(%q) = %v, want %v", tt.mediaType, got, tt.want)
+		}
+	}
+}
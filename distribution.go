@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	// tagsPageSize is the page size requested from /v2/<name>/tags/list
+	tagsPageSize = 100
+	// maxTagPages bounds how many pages of tags are fetched per poll
+	maxTagPages = 50
+)
+
+// authenticatorFor converts provider credentials into a go-containerregistry
+// authenticator, falling back to anonymous access when none are set.
+func authenticatorFor(cred Credential) authn.Authenticator {
+	if cred.Empty() {
+		return authn.Anonymous
+	}
+	return &authn.Basic{Username: cred.Username, Password: cred.Password}
+}
+
+// isDigest reports whether version is a manifest digest such as
+// "sha256:abc..." rather than a tag.
+func isDigest(version string) bool {
+	_, err := v1.NewHash(version)
+	return err == nil
+}
+
+// referenceFor returns the pullable reference of version in repo, using
+// repo@digest for digests and repo:tag otherwise.
+func referenceFor(repo name.Repository, version string) string {
+	if isDigest(version) {
+		return repo.Digest(version).Name()
+	}
+	return repo.Tag(version).Name()
+}
+
+// listTags lists every tag of repo through the OCI distribution API,
+// following Link headers for pagination. Token (bearer) and basic auth
+// challenges are handled by the go-containerregistry transport.
+func listTags(ctx context.Context, config *Config, repo name.Repository, auth authn.Authenticator) ([]string, error) {
+	tr, err := transport.NewWithContext(ctx, repo.Registry, auth, httpTransport(config),
+		[]string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, fmt.Errorf("authenticating to %s: %w", repo.RegistryStr(), err)
+	}
+	client := &http.Client{Transport: tr}
+
+	next := &url.URL{
+		Scheme:   repo.Scheme(),
+		Host:     repo.RegistryStr(),
+		Path:     fmt.Sprintf("/v2/%s/tags/list", repo.RepositoryStr()),
+		RawQuery: fmt.Sprintf("n=%d", tagsPageSize),
+	}
+
+	var tags []string
+	for page := 0; next != nil; page++ {
+		if page >= maxTagPages {
+			return nil, fmt.Errorf("listing tags of %s: more than %d pages", repo.Name(), maxTagPages)
+		}
+
+		pageTags, link, err := fetchTagsPage(ctx, client, next)
+		if err != nil {
+			return nil, fmt.Errorf("listing tags of %s: %w", repo.Name(), err)
+		}
+		tags = append(tags, pageTags...)
+
+		next, err = nextPageURL(next, link)
+		if err != nil {
+			return nil, fmt.Errorf("listing tags of %s: %w", repo.Name(), err)
+		}
+	}
+
+	log.Printf("Found %d tag(s) in %s\n", len(tags), repo.Name())
+
+	return tags, nil
+}
+
+// latestListedTag lists the tags of repo and returns the newest candidate
+// left by the configured tag filters, ordered by config.TagOrder
+// (TagOrderSemver when empty). When the registry is unavailable the mirrors
+// are listed in order; versions older than the last applied one are
+// ignored there so that a lagging mirror cannot roll back.
+func latestListedTag(ctx context.Context, config *Config, provider Provider, repo name.Repository) (string, error) {
+	order := config.TagOrder
+	if order == "" {
+		order = TagOrderSemver
+	}
+
+	keychain := keychainFor(ctx, config, provider)
+	var listErr error
+	for i, candidate := range mirrorRepositories(config, repo) {
+		if i > 0 {
+			log.Printf("Warning: listing tags of %s failed, trying mirror %s: %v\n", repo.Name(), candidate.RegistryStr(), listErr)
+		}
+
+		auth, err := keychain.Resolve(candidate)
+		if err != nil {
+			return "", err
+		}
+		tags, err := listTags(ctx, config, candidate, auth)
+		if err != nil {
+			listErr = err
+			continue
+		}
+
+		tags, err = filterCandidateTags(config, tags)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			var current []string
+			for _, tag := range tags {
+				if olderThanApplied(config, tag, order) {
+					log.Printf("Warning: ignoring tag %s of mirror %s, older than the applied version\n", tag, candidate.RegistryStr())
+					continue
+				}
+				current = append(current, tag)
+			}
+			tags = current
+		}
+
+		latest, err := newestTag(tags, order)
+		if err != nil {
+			return "", err
+		}
+		if latest == "" && len(tags) > 0 {
+			log.Printf("None of the %d tag(s) in %s can be ordered as %s\n", len(tags), candidate.Name(), order)
+		}
+		if i > 0 && latest != "" {
+			log.Printf("Version %s served by mirror %s\n", latest, candidate.RegistryStr())
+		}
+
+		return latest, nil
+	}
+
+	return "", listErr
+}
+
+func fetchTagsPage(ctx context.Context, client *http.Client, u *url.URL) ([]string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("requesting %s: %w", u.Redacted(), err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Warning: failed to close response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, "", fmt.Errorf("registry returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var list struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", fmt.Errorf("decoding tags list: %w", err)
+	}
+
+	return list.Tags, resp.Header.Get("Link"), nil
+}
+
+// nextPageURL resolves the rel="next" target of a Link header against the
+// current page URL. It returns nil when there is no next page.
+func nextPageURL(current *url.URL, linkHeader string) (*url.URL, error) {
+	target := parseNextLink(linkHeader)
+	if target == "" {
+		return nil, nil
+	}
+
+	next, err := current.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Link header %q: %w", linkHeader, err)
+	}
+	if next.Host != current.Host {
+		return nil, fmt.Errorf("refusing to follow Link header to another host: %s", next.Host)
+	}
+
+	return next, nil
+}
+
+// parseNextLink extracts the rel="next" target from an RFC 8288 Link header
+// such as `</v2/foo/tags/list?n=100&last=v1>; rel="next"`.
+func parseNextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		segments := strings.Split(link, ";")
+		target := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		for _, param := range segments[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.TrimSpace(key) != "rel" {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+				if rel == "next" {
+					return strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseNextLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{
+			name:   "distribution style",
+			header: `</v2/team/policies/tags/list?n=100&last=v1>; rel="next"`,
+			want:   "/v2/team/policies/tags/list?n=100&last=v1",
+		},
+		{
+			name:   "github style with several relations",
+			header: `<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`,
+			want:   "https://api.github.com/x?page=2",
+		},
+		{
+			name:   "next not first",
+			header: `<https://api.github.com/x?page=1>; rel="prev", <https://api.github.com/x?page=3>; rel="next"`,
+			want:   "https://api.github.com/x?page=3",
+		},
+		{
+			name:   "unquoted relation",
+			header: `</v2/x/tags/list?last=a>; rel=next`,
+			want:   "/v2/x/tags/list?last=a",
+		},
+		{
+			name:   "no next",
+			header: `<https://api.github.com/x?page=1>; rel="prev"`,
+			want:   "",
+		},
+		{
+			name:   "empty",
+			header: "",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNextLink(tt.header); got != tt.want {
+				t.Errorf("parseNextLink(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dockerConfigFile reads per-registry credentials from a Docker config.json
+// or a Kubernetes pull secret (.dockerconfigjson or legacy .dockercfg). The
+// file is re-read whenever it changes, so rotated secrets mounted into the
+// pod are picked up without a restart.
+type dockerConfigFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	auths   map[string]Credential
+}
+
+func newDockerConfigFile(path string) *dockerConfigFile {
+	return &dockerConfigFile{path: path}
+}
+
+// credential returns the credentials stored for registry and whether there
+// were any.
+func (f *dockerConfigFile) credential(registry string) (Credential, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.reload(); err != nil {
+		return Credential{}, false, err
+	}
+	cred, ok := f.auths[registry]
+	return cred, ok, nil
+}
+
+// load reads the file, reporting whether it is usable.
+func (f *dockerConfigFile) load() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.reload()
+}
+
+// reload re-reads the file when its modification time or size changed since
+// the last read. Callers must hold f.mu.
+func (f *dockerConfigFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("reading docker config %s: %w", f.path, err)
+	}
+	if f.auths != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("reading docker config %s: %w", f.path, err)
+	}
+	auths, err := parseDockerConfig(data)
+	if err != nil {
+		return fmt.Errorf("parsing docker config %s: %w", f.path, err)
+	}
+
+	if f.auths != nil {
+		log.Printf("Reloaded registry credentials from %s\n", f.path)
+	}
+	f.auths = auths
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+
+	return nil
+}
+
+// dockerConfigAuth is a single registry entry of a Docker config file.
+type dockerConfigAuth struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// parseDockerConfig returns the credentials of a config.json/.dockerconfigjson
+// ({"auths": {...}}) or a legacy .dockercfg (entries at the top level),
+// keyed by registry host.
+func parseDockerConfig(data []byte) (map[string]Credential, error) {
+	var config struct {
+		Auths map[string]dockerConfigAuth `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	entries := config.Auths
+	if entries == nil {
+		// Config files naming only credsStore or credHelpers are not legacy
+		// .dockercfg files and hold no credentials
+		if err := json.Unmarshal(data, &entries); err != nil {
+			entries = nil
+		}
+	}
+
+	auths := map[string]Credential{}
+	for key, entry := range entries {
+		cred := Credential{Username: entry.Username, Password: entry.Password}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth for %s: %w", key, err)
+			}
+			username, password, ok := strings.Cut(string(decoded), ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid auth for %s: expected base64 of username:password", key)
+			}
+			cred = Credential{Username: username, Password: password}
+		}
+		auths[dockerConfigRegistry(key)] = cred
+	}
+
+	return auths, nil
+}
+
+// dockerConfigRegistry returns the registry host of a config key, which may
+// be a URL such as "https://index.docker.io/v1/".
+func dockerConfigRegistry(key string) string {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ := strings.Cut(key, "/")
+	return host
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestDockerConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".dockerconfigjson")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("robot:p@ss:word"))
+
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]Credential
+		wantErr bool
+	}{
+		{
+			name:    "dockerconfigjson with auth",
+			content: `{"auths":{"registry.example.com":{"auth":"` + auth + `"}}}`,
+			want:    map[string]Credential{"registry.example.com": {Username: "robot", Password: "p@ss:word"}},
+		},
+		{
+			name:    "username and password with URL keys",
+			content: `{"auths":{"https://index.docker.io/v1/":{"username":"hub","password":"token"},"http://localhost:5000":{"username":"local","password":"x"}}}`,
+			want: map[string]Credential{
+				"index.docker.io": {Username: "hub", Password: "token"},
+				"localhost:5000":  {Username: "local", Password: "x"},
+			},
+		},
+		{
+			name:    "legacy dockercfg",
+			content: `{"registry.example.com":{"auth":"` + auth + `","email":"robot@example.com"}}`,
+			want:    map[string]Credential{"registry.example.com": {Username: "robot", Password: "p@ss:word"}},
+		},
+		{
+			name:    "credential store only",
+			content: `{"credsStore":"desktop"}`,
+			want:    map[string]Credential{},
+		},
+		{
+			name:    "invalid auth",
+			content: `{"auths":{"registry.example.com":{"auth":"bm9jb2xvbg=="}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			content: `auths:`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDockerConfig([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDockerConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseDockerConfig() = %+v, want %+v", got, tt.want)
+			}
+			for registry, cred := range tt.want {
+				if got[registry] != cred {
+					t.Errorf("parseDockerConfig()[%q] = %+v, want %+v", registry, got[registry], cred)
+				}
+			}
+		})
+	}
+}
+
+func TestDockerConfigFileReloads(t *testing.T) {
+	path := writeTestDockerConfig(t, `{"auths":{"registry.example.com":{"username":"robot","password":"old"}}}`)
+	f := newDockerConfigFile(path)
+
+	cred, ok, err := f.credential("registry.example.com")
+	if err != nil || !ok || cred.Password != "old" {
+		t.Fatalf("credential() = %+v, %v, %v, want the old password", cred, ok, err)
+	}
+	if _, ok, _ := f.credential("other.example.com"); ok {
+		t.Error("credential() found credentials for a registry not in the file")
+	}
+
+	// Rotate the secret as kubelet does for mounted secrets
+	if err := os.WriteFile(path, []byte(`{"auths":{"registry.example.com":{"username":"robot","password":"new"}}}`), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+
+	cred, ok, err = f.credential("registry.example.com")
+	if err != nil || !ok || cred.Password != "new" {
+		t.Errorf("credential() = %+v, %v, %v after rotation, want the new password", cred, ok, err)
+	}
+}
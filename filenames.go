@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// maxFileNameLength bounds names taken from layer titles
+const maxFileNameLength = 128
+
+// unsafeFileNameChars matches everything that is replaced in layer titles
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// layerNames hands out the names the layers of one pull are written to.
+// Names come from the org.opencontainers.image.title annotation that
+// `kyverno oci push` and `oras push` record, falling back to policy-N.yaml
+// and layer-N.yaml for untitled layers.
+type layerNames struct {
+	// used holds the lower-cased names handed out so far, so that names
+	// differing only in case do not collide on case-insensitive filesystems
+	used map[string]bool
+}
+
+func newLayerNames() *layerNames {
+	return &layerNames{used: map[string]bool{}}
+}
+
+// file returns the file name of a single-document layer. It always ends in
+// .yaml or .yml so the apply step picks it up.
+func (n *layerNames) file(title string, mediaType types.MediaType, index int) string {
+	name := sanitizeTitle(title)
+	if name == "" {
+		name = fmt.Sprintf("layer-%d.yaml", index)
+		if mediaType == PolicyLayerMediaType {
+			name = fmt.Sprintf("policy-%d.yaml", index)
+		}
+	}
+	if ext := strings.ToLower(filepath.Ext(name)); ext != ".yaml" && ext != ".yml" {
+		name += ".yaml"
+	}
+	return n.claim(name, filepath.Ext(name))
+}
+
+// dir returns the directory an archive layer is unpacked into, its title
+// without the archive extension or layer-N.
+func (n *layerNames) dir(title string, index int) string {
+	name := sanitizeTitle(title)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("layer-%d", index)
+	}
+	return n.claim(name, "")
+}
+
+// claim reserves name, adding a -1, -2, ... suffix before ext when it is
+// already taken.
+func (n *layerNames) claim(name, ext string) string {
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; n.used[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+	n.used[strings.ToLower(name)] = true
+	return name
+}
+
+// sanitizeTitle turns a layer title into a plain file name: directories are
+// dropped, unsafe characters replaced and leading dots removed, so a title
+// can neither escape the output directory nor hide the file. An unusable
+// title yields "".
+func sanitizeTitle(title string) string {
+	name := path.Base(strings.ReplaceAll(title, `\`, "/"))
+	name = unsafeFileNameChars.ReplaceAllString(name, "-")
+	name = strings.TrimLeft(name, ".-")
+
+	if len(name) > maxFileNameLength {
+		ext := filepath.Ext(name)
+		if len(ext) >= maxFileNameLength {
+			ext = ""
+		}
+		name = name[:maxFileNameLength-len(ext)] + ext
+	}
+	return name
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestSanitizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{title: "require-labels.yaml", want: "require-labels.yaml"},
+		{title: "policies/require-labels.yaml", want: "require-labels.yaml"},
+		{title: "../../etc/cron.d/evil.yaml", want: "evil.yaml"},
+		{title: `..\..\evil.yaml`, want: "evil.yaml"},
+		{title: ".hidden.yaml", want: "hidden.yaml"},
+		{title: "disallow latest (v2).yaml", want: "disallow-latest-v2-.yaml"},
+		{title: "..", want: ""},
+		{title: "/", want: ""},
+		{title: "", want: ""},
+		{title: strings.Repeat("a", 200) + ".yaml", want: strings.Repeat("a", maxFileNameLength-len(".yaml")) + ".yaml"},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeTitle(tt.title); got != tt.want {
+			t.Errorf("sanitizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestLayerNames(t *testing.T) {
+	names := newLayerNames()
+
+	got := []string{
+		names.file("require-labels.yaml", PolicyLayerMediaType, 0),
+		names.file("require-labels.yaml", PolicyLayerMediaType, 1),
+		names.file("Require-Labels.yaml", PolicyLayerMediaType, 2),
+		names.file("disallow-latest", PolicyLayerMediaType, 3),
+		names.file("", PolicyLayerMediaType, 4),
+		names.file("policy-5.yaml", PolicyLayerMediaType, 5),
+		names.file("", PolicyLayerMediaType, 5),
+		names.file("", "application/yaml", 6),
+		names.dir("bundle.tar.gz", 7),
+		names.dir("", 8),
+	}
+	want := []string{
+		"require-labels.yaml",
+		"require-labels-1.yaml",
+		"Require-Labels-2.yaml",
+		"disallow-latest.yaml",
+		"policy-4.yaml",
+		"policy-5.yaml",
+		"policy-5-1.yaml",
+		"layer-6.yaml",
+		"bundle",
+		"layer-8",
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("name %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExtractImageUsesLayerTitles(t *testing.T) {
+	img := empty.Image
+	for _, title := range []string{"require-labels.yaml", "../disallow-latest.yaml", "require-labels.yaml", ""} {
+		var err error
+		img, err = mutate.Append(img, mutate.Addendum{
+			Layer:       static.NewLayer([]byte(testPolicyYAML), PolicyLayerMediaType),
+			Annotations: map[string]string{ocispec.AnnotationTitle: title},
+		})
+		if err != nil {
+			t.Fatalf("building image: %v", err)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := extractImage(&Config{}, img, dir); err != nil {
+		t.Fatalf("extractImage() error = %v", err)
+	}
+
+	for _, name := range []string{"require-labels.yaml", "disallow-latest.yaml", "require-labels-1.yaml", "policy-3.yaml"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not extracted: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "disallow-latest.yaml")); !os.IsNotExist(err) {
+		t.Errorf("title escaped the output directory: %v", err)
+	}
+}
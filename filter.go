@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// maxLoggedSkippedTags bounds how many skipped tags are named per log line
+const maxLoggedSkippedTags = 10
+
+// tagFilter decides which discovered tags are candidates for selection.
+type tagFilter struct {
+	include           *regexp.Regexp
+	exclude           *regexp.Regexp
+	constraint        *versionConstraint
+	includePrerelease bool
+}
+
+// newTagFilter compiles the tag filters configured in config.
+func newTagFilter(config *Config) (*tagFilter, error) {
+	f := &tagFilter{includePrerelease: config.IncludePrerelease}
+
+	var err error
+	if config.TagIncludeRegex != "" {
+		if f.include, err = regexp.Compile(config.TagIncludeRegex); err != nil {
+			return nil, fmt.Errorf("invalid TAG_INCLUDE_REGEX: %v", err)
+		}
+	}
+	if config.TagExcludeRegex != "" {
+		if f.exclude, err = regexp.Compile(config.TagExcludeRegex); err != nil {
+			return nil, fmt.Errorf("invalid TAG_EXCLUDE_REGEX: %v", err)
+		}
+	}
+	if config.VersionConstraint != "" {
+		if f.constraint, err = parseConstraint(config.VersionConstraint); err != nil {
+			return nil, fmt.Errorf("invalid VERSION_CONSTRAINT: %v", err)
+		}
+	}
+
+	return f, nil
+}
+
+// skipReason returns why tag is not a candidate, or "" if it is one.
+func (f *tagFilter) skipReason(tag string) string {
+	if f.include != nil && !f.include.MatchString(tag) {
+		return fmt.Sprintf("not matching TAG_INCLUDE_REGEX %q", f.include)
+	}
+	if f.exclude != nil && f.exclude.MatchString(tag) {
+		return fmt.Sprintf("matching TAG_EXCLUDE_REGEX %q", f.exclude)
+	}
+	if f.constraint != nil {
+		v, ok := parseSemver(tag)
+		if !ok {
+			return "not a semver version"
+		}
+		if !f.constraint.Check(v, f.includePrerelease) {
+			return fmt.Sprintf("not satisfying VERSION_CONSTRAINT %q", f.constraint)
+		}
+	}
+	return ""
+}
+
+// filterCandidateTags returns the tags that pass TAG_INCLUDE_REGEX,
+// TAG_EXCLUDE_REGEX and VERSION_CONSTRAINT, logging skipped tags grouped by
+// reason.
+func filterCandidateTags(config *Config, tags []string) ([]string, error) {
+	f, err := newTagFilter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []string
+	var reasons []string
+	skipped := map[string][]string{}
+	for _, tag := range tags {
+		reason := f.skipReason(tag)
+		if reason == "" {
+			candidates = append(candidates, tag)
+			continue
+		}
+		if _, seen := skipped[reason]; !seen {
+			reasons = append(reasons, reason)
+		}
+		skipped[reason] = append(skipped[reason], tag)
+	}
+
+	for _, reason := range reasons {
+		names := skipped[reason]
+		listed := names
+		if len(listed) > maxLoggedSkippedTags {
+			listed = listed[:maxLoggedSkippedTags]
+		}
+		more := ""
+		if len(names) > len(listed) {
+			more = fmt.Sprintf(", ... (%d more)", len(names)-len(listed))
+		}
+		log.Printf("Skipped %d tag(s) %s: %s%s\n", len(names), reason, strings.Join(listed, ", "), more)
+	}
+
+	return candidates, nil
+}
+
+// loadTagFilters reads TAG_INCLUDE_REGEX, TAG_EXCLUDE_REGEX,
+// VERSION_CONSTRAINT and VERSION_INCLUDE_PRERELEASE into config.
+func loadTagFilters(config *Config) error {
+	config.TagIncludeRegex = getEnvFunc("TAG_INCLUDE_REGEX")
+	config.TagExcludeRegex = getEnvFunc("TAG_EXCLUDE_REGEX")
+	config.VersionConstraint = strings.TrimSpace(getEnvFunc("VERSION_CONSTRAINT"))
+	config.IncludePrerelease = strings.EqualFold(getEnvFunc("VERSION_INCLUDE_PRERELEASE"), "true")
+
+	// Validate everything up front so that typos fail at startup
+	if _, err := newTagFilter(config); err != nil {
+		return err
+	}
+
+	if config.TagIncludeRegex != "" {
+		log.Printf("Only considering tags matching %q\n", config.TagIncludeRegex)
+	}
+	if config.TagExcludeRegex != "" {
+		log.Printf("Ignoring tags matching %q\n", config.TagExcludeRegex)
+	}
+
+	return nil
+}
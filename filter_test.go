@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagFilterSkipReason(t *testing.T) {
+	config := &Config{
+		TagIncludeRegex:   `^v\d`,
+		TagExcludeRegex:   `-rc`,
+		VersionConstraint: ">=1.0.0",
+	}
+	f, err := newTagFilter(config)
+	if err != nil {
+		t.Fatalf("newTagFilter() error = %v", err)
+	}
+
+	tests := []struct {
+		tag        string
+		wantReason string
+	}{
+		{tag: "v1.2.0", wantReason: ""},
+		{tag: "pr-42", wantReason: `not matching TAG_INCLUDE_REGEX "^v\\d"`},
+		{tag: "sha-abc123", wantReason: `not matching TAG_INCLUDE_REGEX "^v\\d"`},
+		{tag: "v1.3.0-rc.1", wantReason: `matching TAG_EXCLUDE_REGEX "-rc"`},
+		{tag: "v0.9.0", wantReason: `not satisfying VERSION_CONSTRAINT ">=1.0.0"`},
+		{tag: "v1-nightly", wantReason: "not a semver version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := f.skipReason(tt.tag); got != tt.wantReason {
+				t.Errorf("skipReason(%q) = %q, want %q", tt.tag, got, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestFilterCandidateTags(t *testing.T) {
+	tags := []string{"v1.0.0", "sha-1a2b3c", "pr-17", "v1.1.0", "pr-18", "latest"}
+
+	tests := []struct {
+		name   string
+		config Config
+		want   []string
+	}{
+		{
+			name:   "no filters",
+			config: Config{},
+			want:   tags,
+		},
+		{
+			name:   "include only",
+			config: Config{TagIncludeRegex: `^v\d+\.\d+\.\d+$`},
+			want:   []string{"v1.0.0", "v1.1.0"},
+		},
+		{
+			name:   "exclude only",
+			config: Config{TagExcludeRegex: `^(pr|sha)-`},
+			want:   []string{"v1.0.0", "v1.1.0", "latest"},
+		},
+		{
+			name:   "everything excluded",
+			config: Config{TagExcludeRegex: `.*`},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filterCandidateTags(&tt.config, tags)
+			if err != nil {
+				t.Fatalf("filterCandidateTags() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterCandidateTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTagFilterInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		errContains string
+	}{
+		{name: "include", config: Config{TagIncludeRegex: "("}, errContains: "invalid TAG_INCLUDE_REGEX"},
+		{name: "exclude", config: Config{TagExcludeRegex: "[a-"}, errContains: "invalid TAG_EXCLUDE_REGEX"},
+		{name: "constraint", config: Config{VersionConstraint: ">=banana"}, errContains: "invalid VERSION_CONSTRAINT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newTagFilter(&tt.config)
+			if err == nil || !contains(err.Error(), tt.errContains) {
+				t.Errorf("newTagFilter() error = %v, want to contain %q", err, tt.errContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// githubAppJWTLifetime is how long app JWTs are valid; GitHub allows at most 10 minutes
+	githubAppJWTLifetime = 9 * time.Minute
+	// githubAppClockSkew backdates the JWT issue time to tolerate clock drift
+	githubAppClockSkew = time.Minute
+	// githubAppTokenRefreshMargin is how long before expiry an installation token is renewed
+	githubAppTokenRefreshMargin = 5 * time.Minute
+)
+
+// nowFunc can be overridden in tests
+var nowFunc = time.Now
+
+// loadGitHubAppKey reads an RSA private key in PEM format, accepting both the
+// PKCS#1 keys GitHub generates and PKCS#8 keys.
+func loadGitHubAppKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading GitHub App private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App private key %s is not PEM encoded", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing GitHub App private key %s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key %s is not an RSA key", path)
+	}
+
+	return key, nil
+}
+
+// signGitHubAppJWT returns an RS256 JWT identifying the GitHub App, used to
+// request installation tokens.
+func signGitHubAppJWT(appID string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-githubAppClockSkew).Unix(),
+		"exp": now.Add(githubAppJWTLifetime).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing GitHub App JWT: %w", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// token returns the credential used for the GitHub API and GHCR: the static
+// GITHUB_TOKEN or, in GitHub App mode, a cached installation token that is
+// renewed shortly before it expires.
+func (p *githubProvider) token(ctx context.Context) (string, error) {
+	if p.appKey == nil {
+		return p.config.GithubToken, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.appToken != "" && nowFunc().Add(githubAppTokenRefreshMargin).Before(p.appTokenExpiry) {
+		return p.appToken, nil
+	}
+
+	token, expiry, err := p.installationToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Obtained GitHub App installation token (expires at %s)\n", expiry.Format(time.RFC3339))
+
+	p.appToken = token
+	p.appTokenExpiry = expiry
+
+	return token, nil
+}
+
+// installationToken exchanges an app JWT for an installation access token.
+func (p *githubProvider) installationToken(ctx context.Context) (string, time.Time, error) {
+	config := p.config
+
+	jwt, err := signGitHubAppJWT(config.GithubAppID, p.appKey, nowFunc())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	apiURL := fmt.Sprintf("%s/app/installations/%s/access_tokens", p.apiBaseURL, config.GithubAppInstallationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to request installation token: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Warning: failed to close response body: %v", err)
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var result struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+		Message   string    `json:"message"`
+	}
+	_ = json.Unmarshal(body, &result)
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+	case http.StatusUnauthorized:
+		return "", time.Time{}, fmt.Errorf("GitHub App authentication failed (401): check GITHUB_APP_ID and GITHUB_APP_PRIVATE_KEY_FILE. Message: %s", result.Message)
+	case http.StatusNotFound:
+		return "", time.Time{}, fmt.Errorf("GitHub App installation %s not found (404)", config.GithubAppInstallationID)
+	default:
+		return "", time.Time{}, fmt.Errorf("GitHub API returned status %d for installation token: %s", resp.StatusCode, result.Message)
+	}
+
+	if result.Token == "" {
+		return "", time.Time{}, errors.New("GitHub API returned an empty installation token")
+	}
+
+	return strings.TrimSpace(result.Token), result.ExpiresAt, nil
+}
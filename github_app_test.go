@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeTestGitHubAppKey generates an RSA key and writes it to a temporary
+// PEM file, returning the key and the file path.
+func writeTestGitHubAppKey(t *testing.T, pkcs8 bool) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if pkcs8 {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(t.TempDir(), "app.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	return key, path
+}
+
+// verifyTestJWT checks the RS256 signature of jwt and returns its claims.
+func verifyTestJWT(jwt string, pub *rsa.PublicKey) (map[string]any, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT %q", jwt)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func TestGitHubAppInstallationTokenCaching(t *testing.T) {
+	key, keyFile := writeTestGitHubAppKey(t, false)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	setTestNow(t, &now)
+
+	var tokenRequests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/app/installations/42/access_tokens":
+			claims, err := verifyTestJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &key.PublicKey)
+			if err != nil {
+				t.Errorf("invalid app JWT: %v", err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if claims["iss"] != "123" {
+				t.Errorf("JWT iss = %v, want %q", claims["iss"], "123")
+			}
+
+			n := tokenRequests.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"token":      fmt.Sprintf("ghs_%d", n),
+				"expires_at": now.Add(time.Hour),
+			})
+		case strings.HasSuffix(r.URL.Path, "/versions"):
+			want := fmt.Sprintf("token ghs_%d", tokenRequests.Load())
+			if got := r.Header.Get("Authorization"); got != want {
+				t.Errorf("Authorization = %q, want %q", got, want)
+			}
+			_ = json.NewEncoder(w).Encode([]GitHubPackageVersion{githubTestVersion(1, now, "v1.0.0")})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := mustGitHubProvider(t, &Config{
+		ImageBase:               "ghcr.io/owner/policies",
+		Owner:                   "owner",
+		Package:                 "policies",
+		PackageNormalized:       "policies",
+		GithubAPIOwnerType:      "orgs",
+		GithubAppID:             "123",
+		GithubAppInstallationID: "42",
+		GithubAppPrivateKeyFile: keyFile,
+	})
+	p.apiBaseURL = srv.URL
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.LatestVersion(context.Background()); err != nil {
+			t.Fatalf("LatestVersion() error = %v", err)
+		}
+	}
+	cred, err := p.Credentials(context.Background(), "ghcr.io")
+	if err != nil {
+		t.Fatalf("Credentials() error = %v", err)
+	}
+	if cred.Username != githubTokenUsername || cred.Password != "ghs_1" {
+		t.Errorf("Credentials() = %+v, want installation token ghs_1", cred)
+	}
+	if got := tokenRequests.Load(); got != 1 {
+		t.Errorf("token requests = %d, want 1 (token should be cached)", got)
+	}
+
+	// Close to expiry the token is renewed
+	now = now.Add(58 * time.Minute)
+	if _, err := p.LatestVersion(context.Background()); err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if got := tokenRequests.Load(); got != 2 {
+		t.Errorf("token requests = %d, want 2 (token should be refreshed)", got)
+	}
+}
+
+func TestGitHubAppInstallationTokenErrors(t *testing.T) {
+	_, keyFile := writeTestGitHubAppKey(t, false)
+
+	tests := []struct {
+		name        string
+		status      int
+		errContains string
+	}{
+		{
+			name:        "unauthorized",
+			status:      http.StatusUnauthorized,
+			errContains: "GitHub App authentication failed (401)",
+		},
+		{
+			name:        "installation not found",
+			status:      http.StatusNotFound,
+			errContains: "GitHub App installation 42 not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"message":"nope"}`))
+			}))
+			defer srv.Close()
+
+			p := mustGitHubProvider(t, &Config{
+				ImageBase:               "ghcr.io/owner/policies",
+				GithubAppID:             "123",
+				GithubAppInstallationID: "42",
+				GithubAppPrivateKeyFile: keyFile,
+			})
+			p.apiBaseURL = srv.URL
+
+			_, err := p.Credentials(context.Background(), "ghcr.io")
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("Credentials() error = %v, want to contain %q", err, tt.errContains)
+			}
+		})
+	}
+}
+
+func TestLoadGitHubAppKey(t *testing.T) {
+	for _, pkcs8 := range []bool{false, true} {
+		key, path := writeTestGitHubAppKey(t, pkcs8)
+		got, err := loadGitHubAppKey(path)
+		if err != nil {
+			t.Fatalf("loadGitHubAppKey(pkcs8=%v) error = %v", pkcs8, err)
+		}
+		if !got.Equal(key) {
+			t.Errorf("loadGitHubAppKey(pkcs8=%v) returned a different key", pkcs8)
+		}
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(notPEM, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := loadGitHubAppKey(notPEM); err == nil || !strings.Contains(err.Error(), "not PEM encoded") {
+		t.Errorf("loadGitHubAppKey() error = %v, want PEM error", err)
+	}
+
+	if _, err := loadGitHubAppKey(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("loadGitHubAppKey() should fail for a missing file")
+	}
+}
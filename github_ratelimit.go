@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// githubRateLimitLowDivisor defines a low budget as less than 1/10th of the
+// rate limit remaining, at which point polling slows down.
+const githubRateLimitLowDivisor = 10
+
+// githubRateLimit is the rate-limit state reported by a GitHub API response.
+type githubRateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// parseGitHubRateLimit reads the X-RateLimit-* headers. ok is false when the
+// response carries none.
+func parseGitHubRateLimit(h http.Header) (rl githubRateLimit, ok bool) {
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return githubRateLimit{}, false
+	}
+	rl.Remaining = remaining
+	rl.Limit, _ = strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rl.Reset = time.Unix(reset, 0)
+	}
+	return rl, true
+}
+
+// parseRetryAfter returns the time a Retry-After header (seconds or HTTP
+// date) asks clients to wait until.
+func parseRetryAfter(h http.Header, now time.Time) (time.Time, bool) {
+	value := strings.TrimSpace(h.Get("Retry-After"))
+	if value == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// githubRateLimitedUntil reports whether an error response is a primary or
+// secondary rate limit and until when requests should be paused.
+func githubRateLimitedUntil(resp *http.Response) (time.Time, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+
+	now := nowFunc()
+	if until, ok := parseRetryAfter(resp.Header, now); ok {
+		return until, true
+	}
+	if rl, ok := parseGitHubRateLimit(resp.Header); ok && rl.Remaining == 0 {
+		if rl.Reset.After(now) {
+			return rl.Reset, true
+		}
+		return now.Add(time.Minute), true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// Secondary rate limits without Retry-After ask for at least a minute
+		return now.Add(time.Minute), true
+	}
+
+	return time.Time{}, false
+}
+
+// low reports whether the remaining budget dropped below the low watermark.
+func (rl githubRateLimit) low() bool {
+	return rl.Limit > 0 && rl.Remaining < rl.Limit/githubRateLimitLowDivisor
+}
+
+// spacing returns the delay between requests that spreads the remaining
+// budget evenly until the rate limit resets.
+func (rl githubRateLimit) spacing(now time.Time) time.Duration {
+	untilReset := rl.Reset.Sub(now)
+	if untilReset <= 0 {
+		return 0
+	}
+	if rl.Remaining <= 0 {
+		return untilReset
+	}
+	return untilReset / time.Duration(rl.Remaining)
+}
+
+func (rl githubRateLimit) String() string {
+	if rl.Reset.IsZero() {
+		return fmt.Sprintf("%d/%d requests remaining", rl.Remaining, rl.Limit)
+	}
+	return fmt.Sprintf("%d/%d requests remaining, resets at %s", rl.Remaining, rl.Limit, rl.Reset.Format(time.RFC3339))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseGitHubRateLimit(t *testing.T) {
+	h := http.Header{}
+	if _, ok := parseGitHubRateLimit(h); ok {
+		t.Error("parseGitHubRateLimit() ok = true without headers")
+	}
+
+	h.Set("X-RateLimit-Limit", "5000")
+	h.Set("X-RateLimit-Remaining", "42")
+	h.Set("X-RateLimit-Reset", "1704110400")
+	rl, ok := parseGitHubRateLimit(h)
+	if !ok {
+		t.Fatal("parseGitHubRateLimit() ok = false")
+	}
+	want := githubRateLimit{Limit: 5000, Remaining: 42, Reset: time.Unix(1704110400, 0)}
+	if rl != want {
+		t.Errorf("parseGitHubRateLimit() = %+v, want %+v", rl, want)
+	}
+	if !rl.low() {
+		t.Error("low() = false, want true for 42/5000")
+	}
+	if got := rl.spacing(want.Reset.Add(-42 * time.Minute)); got != time.Minute {
+		t.Errorf("spacing() = %v, want 1m", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "missing", value: ""},
+		{name: "seconds", value: "90", want: now.Add(90 * time.Second), wantOK: true},
+		{name: "http date", value: "Mon, 01 Jan 2024 12:05:00 GMT", want: now.Add(5 * time.Minute), wantOK: true},
+		{name: "garbage", value: "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.value != "" {
+				h.Set("Retry-After", tt.value)
+			}
+			got, ok := parseRetryAfter(h, now)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// setTestNow pins nowFunc to *now for the duration of the test.
+func setTestNow(t *testing.T, now *time.Time) {
+	t.Helper()
+	originalNowFunc := nowFunc
+	nowFunc = func() time.Time { return *now }
+	t.Cleanup(func() {
+		nowFunc = originalNowFunc
+	})
+}
+
+func TestGitHubProviderConditionalRequests(t *testing.T) {
+	versions := []GitHubPackageVersion{githubTestVersion(1, time.Now(), "v1.0.0")}
+
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_ = json.NewEncoder(w).Encode(versions)
+	}))
+	defer srv.Close()
+
+	p := newTestGitHubProvider(t, srv.URL)
+	for i := 0; i < 3; i++ {
+		latest, err := p.LatestVersion(context.Background())
+		if err != nil {
+			t.Fatalf("LatestVersion() error = %v", err)
+		}
+		if latest != "v1.0.0" {
+			t.Errorf("LatestVersion() = %q, want %q", latest, "v1.0.0")
+		}
+	}
+
+	if requests != 3 || notModified != 2 {
+		t.Errorf("requests = %d (304: %d), want 3 requests with 2 conditional hits", requests, notModified)
+	}
+}
+
+func TestGitHubProviderSlowsDownOnLowRateLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	setTestNow(t, &now)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "60")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Hour).Unix(), 10))
+		_ = json.NewEncoder(w).Encode([]GitHubPackageVersion{githubTestVersion(1, now, "v1.0.0")})
+	}))
+	defer srv.Close()
+
+	p := newTestGitHubProvider(t, srv.URL)
+	poll := func() {
+		t.Helper()
+		latest, err := p.LatestVersion(context.Background())
+		if err != nil {
+			t.Fatalf("LatestVersion() error = %v", err)
+		}
+		if latest != "v1.0.0" {
+			t.Errorf("LatestVersion() = %q, want %q", latest, "v1.0.0")
+		}
+	}
+
+	// 60 requests left for an hour: one request per minute
+	poll()
+	now = now.Add(30 * time.Second)
+	poll()
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1 (second poll should reuse versions)", requests)
+	}
+
+	now = now.Add(31 * time.Second)
+	poll()
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2 after the spacing elapsed", requests)
+	}
+}
+
+func TestGitHubProviderRateLimitExceeded(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	setTestNow(t, &now)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+	}))
+	defer srv.Close()
+
+	p := newTestGitHubProvider(t, srv.URL)
+	_, err := p.LatestVersion(context.Background())
+	if err == nil || !contains(err.Error(), "rate limit exceeded (403)") {
+		t.Fatalf("LatestVersion() error = %v, want rate limit error", err)
+	}
+
+	_, err = p.LatestVersion(context.Background())
+	if err == nil || !contains(err.Error(), "rate limited until") {
+		t.Errorf("LatestVersion() error = %v, want rate limited error", err)
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1 (no requests before the reset)", requests)
+	}
+}
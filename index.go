@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+)
+
+const (
+	// indexSelectorPlatform selects index children by os/arch[/variant]
+	indexSelectorPlatform = "platform"
+	// maxIndexDepth bounds how many nested indexes are walked
+	maxIndexDepth = 4
+)
+
+// loadIndexSelector reads INDEX_SELECTOR, the comma separated key=value
+// pairs choosing the child manifest of an image index. Keys are manifest
+// annotations such as kyverno.io/min-version, or "platform" matching
+// os/arch[/variant].
+func loadIndexSelector(config *Config) error {
+	entries := splitList(getEnvFunc("INDEX_SELECTOR"))
+	if len(entries) == 0 {
+		config.IndexSelector = nil
+		return nil
+	}
+
+	selector := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return fmt.Errorf("invalid INDEX_SELECTOR entry: %s (must be key=value)", entry)
+		}
+		selector[key] = value
+	}
+	log.Printf("Selecting image index manifests by %s\n", formatSelector(selector))
+
+	config.IndexSelector = selector
+	return nil
+}
+
+// indexEntry is a child manifest of an image index.
+type indexEntry struct {
+	digest      string
+	annotations map[string]string
+	// platform is os/arch[/variant], empty when the index names none
+	platform string
+}
+
+func platformString(osName, arch, variant string) string {
+	if osName == "" && arch == "" {
+		return ""
+	}
+	if variant != "" {
+		return osName + "/" + arch + "/" + variant
+	}
+	return osName + "/" + arch
+}
+
+// matches reports whether e satisfies every pair of selector. A platform
+// without variant matches every variant.
+func (e indexEntry) matches(selector map[string]string) bool {
+	for key, value := range selector {
+		if key == indexSelectorPlatform {
+			if e.platform != value && !strings.HasPrefix(e.platform, value+"/") {
+				return false
+			}
+			continue
+		}
+		if e.annotations[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (e indexEntry) String() string {
+	var attrs []string
+	if e.platform != "" {
+		attrs = append(attrs, indexSelectorPlatform+"="+e.platform)
+	}
+	for key, value := range e.annotations {
+		attrs = append(attrs, key+"="+value)
+	}
+	sort.Strings(attrs)
+	return fmt.Sprintf("%s (%s)", e.digest, strings.Join(attrs, ", "))
+}
+
+// selectIndexEntry returns the position of the child manifest chosen by
+// INDEX_SELECTOR. Without a selector an index with a single manifest is
+// accepted. No match and several matches are errors so that the wrong
+// policies are never applied.
+func selectIndexEntry(config *Config, entries []indexEntry) (int, error) {
+	available := make([]string, len(entries))
+	for i, e := range entries {
+		available[i] = e.String()
+	}
+
+	if len(config.IndexSelector) == 0 {
+		if len(entries) == 1 {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("image index has %d manifests, set INDEX_SELECTOR to choose one of: %s",
+			len(entries), strings.Join(available, "; "))
+	}
+
+	var matched []int
+	for i, e := range entries {
+		if e.matches(config.IndexSelector) {
+			matched = append(matched, i)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return 0, fmt.Errorf("no manifest in image index matches INDEX_SELECTOR %s, available: %s",
+			formatSelector(config.IndexSelector), strings.Join(available, "; "))
+	case 1:
+		log.Printf("Selected manifest %s from image index\n", available[matched[0]])
+		return matched[0], nil
+	default:
+		return 0, fmt.Errorf("%d manifests in image index match INDEX_SELECTOR %s, make it more specific",
+			len(matched), formatSelector(config.IndexSelector))
+	}
+}
+
+func formatSelector(selector map[string]string) string {
+	pairs := make([]string, 0, len(selector))
+	for key, value := range selector {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// selectImage walks idx, and any nested index, down to the image chosen by
+// INDEX_SELECTOR.
+func selectImage(config *Config, idx v1.ImageIndex) (v1.Image, error) {
+	for depth := 0; depth < maxIndexDepth; depth++ {
+		manifest, err := idx.IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("reading image index: %w", err)
+		}
+
+		entries := make([]indexEntry, len(manifest.Manifests))
+		for i, desc := range manifest.Manifests {
+			entries[i] = indexEntry{digest: desc.Digest.String(), annotations: desc.Annotations}
+			if desc.Platform != nil {
+				entries[i].platform = platformString(desc.Platform.OS, desc.Platform.Architecture, desc.Platform.Variant)
+			}
+		}
+		i, err := selectIndexEntry(config, entries)
+		if err != nil {
+			return nil, err
+		}
+
+		child := manifest.Manifests[i]
+		if !child.MediaType.IsIndex() {
+			return idx.Image(child.Digest)
+		}
+		if idx, err = idx.ImageIndex(child.Digest); err != nil {
+			return nil, fmt.Errorf("reading nested image index %s: %w", child.Digest, err)
+		}
+	}
+	return nil, fmt.Errorf("image indexes nested deeper than %d levels", maxIndexDepth)
+}
+
+// orasSelectManifest walks from desc, when it is an image index, down to the
+// manifest chosen by INDEX_SELECTOR.
+func orasSelectManifest(ctx context.Context, config *Config, fetcher content.Fetcher, desc ocispec.Descriptor) (ocispec.Descriptor, error) {
+	for depth := 0; types.MediaType(desc.MediaType).IsIndex(); depth++ {
+		if depth == maxIndexDepth {
+			return ocispec.Descriptor{}, fmt.Errorf("image indexes nested deeper than %d levels", maxIndexDepth)
+		}
+
+		raw, err := content.FetchAll(ctx, fetcher, desc)
+		if err != nil {
+			return ocispec.Descriptor{}, fmt.Errorf("fetching image index: %w", err)
+		}
+		var index ocispec.Index
+		if err := json.Unmarshal(raw, &index); err != nil {
+			return ocispec.Descriptor{}, fmt.Errorf("parsing image index: %w", err)
+		}
+
+		entries := make([]indexEntry, len(index.Manifests))
+		for i, child := range index.Manifests {
+			entries[i] = indexEntry{digest: child.Digest.String(), annotations: child.Annotations}
+			if child.Platform != nil {
+				entries[i].platform = platformString(child.Platform.OS, child.Platform.Architecture, child.Platform.Variant)
+			}
+		}
+		i, err := selectIndexEntry(config, entries)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		desc = index.Manifests[i]
+	}
+	return desc, nil
+}
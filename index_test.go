@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestLoadIndexSelector(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		want        string
+		errContains string
+	}{
+		{name: "unset", value: "", want: ""},
+		{name: "annotation", value: "kyverno.io/min-version=1.12", want: "kyverno.io/min-version=1.12"},
+		{name: "annotation and platform", value: "platform=linux/amd64, kyverno.io/min-version = 1.12", want: "kyverno.io/min-version=1.12,platform=linux/amd64"},
+		{name: "missing value", value: "kyverno.io/min-version", errContains: "invalid INDEX_SELECTOR entry"},
+		{name: "empty value", value: "platform=", errContains: "invalid INDEX_SELECTOR entry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalGetEnvFunc := getEnvFunc
+			getEnvFunc = func(key string) string {
+				if key == "INDEX_SELECTOR" {
+					return tt.value
+				}
+				return ""
+			}
+			defer func() {
+				getEnvFunc = originalGetEnvFunc
+			}()
+
+			config := &Config{}
+			err := loadIndexSelector(config)
+			if tt.errContains != "" {
+				if err == nil || !contains(err.Error(), tt.errContains) {
+					t.Errorf("loadIndexSelector() error = %v, want to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadIndexSelector() error = %v", err)
+			}
+			if got := formatSelector(config.IndexSelector); got != tt.want {
+				t.Errorf("IndexSelector = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectIndexEntry(t *testing.T) {
+	entries := []indexEntry{
+		{digest: "sha256:a", annotations: map[string]string{"kyverno.io/min-version": "1.11"}, platform: "linux/amd64"},
+		{digest: "sha256:b", annotations: map[string]string{"kyverno.io/min-version": "1.12"}, platform: "linux/amd64"},
+		{digest: "sha256:c", annotations: map[string]string{"kyverno.io/min-version": "1.12"}, platform: "linux/arm64/v8"},
+	}
+
+	tests := []struct {
+		name        string
+		entries     []indexEntry
+		selector    map[string]string
+		want        int
+		errContains string
+	}{
+		{name: "single manifest without selector", entries: entries[:1], want: 0},
+		{name: "several manifests without selector", entries: entries, errContains: "set INDEX_SELECTOR"},
+		{name: "annotation", entries: entries[:2], selector: map[string]string{"kyverno.io/min-version": "1.12"}, want: 1},
+		{name: "annotation and platform", entries: entries, selector: map[string]string{"kyverno.io/min-version": "1.12", "platform": "linux/arm64"}, want: 2},
+		{name: "platform with variant", entries: entries, selector: map[string]string{"platform": "linux/arm64/v8"}, want: 2},
+		{name: "no match", entries: entries, selector: map[string]string{"kyverno.io/min-version": "1.13"}, errContains: "no manifest in image index matches"},
+		{name: "ambiguous", entries: entries, selector: map[string]string{"kyverno.io/min-version": "1.12"}, errContains: "2 manifests in image index match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectIndexEntry(&Config{IndexSelector: tt.selector}, tt.entries)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("selectIndexEntry() error = %v, want to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectIndexEntry() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("selectIndexEntry() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// pushPolicyIndex pushes an image index with one titled policy artifact per
+// Kyverno version, annotated with kyverno.io/min-version, to ref.
+func pushPolicyIndex(t *testing.T, ref string, versions ...string) {
+	t.Helper()
+	var idx v1.ImageIndex = empty.Index
+	idx = mutate.IndexMediaType(idx, types.OCIImageIndex)
+	for _, version := range versions {
+		img, err := mutate.Append(empty.Image, mutate.Addendum{
+			Layer:       static.NewLayer([]byte(strings.Replace(testPolicyYAML, "name: ", "name: check-"+version+"-", 1)), PolicyLayerMediaType),
+			Annotations: map[string]string{ocispec.AnnotationTitle: "policy.yaml"},
+		})
+		if err != nil {
+			t.Fatalf("building image: %v", err)
+		}
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Annotations: map[string]string{"kyverno.io/min-version": version},
+			},
+		})
+	}
+
+	tag, err := name.NewTag(ref)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", ref, err)
+	}
+	if err := remote.WriteIndex(tag, idx); err != nil {
+		t.Fatalf("pushing %s: %v", ref, err)
+	}
+}
+
+// readPolicies returns the content of every YAML file below dir.
+func readPolicies(t *testing.T, dir string) string {
+	t.Helper()
+	files, err := findYAMLFiles(dir)
+	if err != nil {
+		t.Fatalf("findYAMLFiles() error = %v", err)
+	}
+	var all strings.Builder
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("reading %s: %v", file, err)
+		}
+		all.Write(data)
+	}
+	return all.String()
+}
+
+func TestPullImageIndex(t *testing.T) {
+	host := newTestRegistry(t)
+	pushPolicyIndex(t, host+"/team/policies:v1", "1.11", "1.12")
+
+	pulls := []struct {
+		name string
+		pull func(config *Config, destDir string) error
+	}{
+		{
+			name: "go-containerregistry",
+			pull: func(config *Config, destDir string) error {
+				return pullImageToDirReal(context.Background(), config, "v1", destDir)
+			},
+		},
+		{
+			name: "oras",
+			pull: func(config *Config, destDir string) error {
+				return orasPull(context.Background(), config, host+"/team/policies:v1", destDir)
+			},
+		},
+	}
+
+	for _, p := range pulls {
+		t.Run(p.name, func(t *testing.T) {
+			config := &Config{
+				Provider:           "oci",
+				ImageBase:          host + "/team/policies",
+				InsecureRegistries: []string{host},
+				IndexSelector:      map[string]string{"kyverno.io/min-version": "1.12"},
+			}
+			destDir := filepath.Join(t.TempDir(), "image")
+			if err := p.pull(config, destDir); err != nil {
+				t.Fatalf("pull error = %v", err)
+			}
+			if got := readPolicies(t, destDir); !strings.Contains(got, "name: check-1.12") || strings.Contains(got, "name: check-1.11") {
+				t.Errorf("pulled policies = %q, want only the 1.12 manifest", got)
+			}
+
+			config = &Config{
+				Provider:           "oci",
+				ImageBase:          host + "/team/policies",
+				InsecureRegistries: []string{host},
+				IndexSelector:      map[string]string{"kyverno.io/min-version": "1.13"},
+			}
+			err := p.pull(config, filepath.Join(t.TempDir(), "image"))
+			if err == nil || !strings.Contains(err.Error(), "no manifest in image index matches INDEX_SELECTOR") {
+				t.Errorf("pull error = %v, want no matching manifest", err)
+			}
+		})
+	}
+}
@@ -169,6 +169,44 @@ func TestAddLabelsToYAMLInvalid(t *testing.T) {
 	}
 }
 
+func TestAddLabelsToYAMLWithDigestVersion(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	inputYAML := `apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: test-policy
+  annotations:
+    policies.kyverno.io/title: Test
+spec:
+  rules:
+  - name: test-rule
+`
+
+	result, err := addLabelsToYAML([]byte(inputYAML), digest)
+	if err != nil {
+		t.Fatalf("addLabelsToYAML() error = %v", err)
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(result, &manifest); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+
+	label := manifest.Metadata.Labels["policy-version"]
+	if len(label) > 63 || strings.Contains(label, ":") {
+		t.Errorf("policy-version label %q is not a valid label value", label)
+	}
+	if !strings.HasPrefix(label, "sha256-abab") {
+		t.Errorf("policy-version label = %q, want shortened digest", label)
+	}
+	if got := manifest.Metadata.Annotations["policy-version"]; got != digest {
+		t.Errorf("policy-version annotation = %q, want %q", got, digest)
+	}
+	if got := manifest.Metadata.Annotations["policies.kyverno.io/title"]; got != "Test" {
+		t.Errorf("existing annotation = %q, want it preserved", got)
+	}
+}
+
 func TestManifestStructPreservesFields(t *testing.T) {
 	// Test that our Manifest struct correctly preserves all important fields
 	inputYAML := `apiVersion: kyverno.io/v1
@@ -438,7 +476,7 @@ func TestLayerFileNaming(t *testing.T) {
 		},
 		{
 			name:      "generic layer",
-			mediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip",
+			mediaType: "application/yaml",
 			layerIdx:  1,
 			wantName:  "layer-1.yaml",
 		},
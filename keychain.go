@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+const (
+	// keychainProvider resolves the credentials of the configured provider
+	keychainProvider = "provider"
+	// keychainDocker resolves credentials from the Docker config file,
+	// including the credsStore and credHelpers it names
+	keychainDocker = "docker"
+	// keychainHelperPrefix selects a standalone docker-credential-<name> helper
+	keychainHelperPrefix = "helper:"
+
+	defaultRegistryKeychain = keychainProvider + "," + keychainDocker
+)
+
+// credentialHelperName matches the <name> of docker-credential-<name>
+var credentialHelperName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// loadKeychainConfig reads REGISTRY_KEYCHAIN, the ordered list of credential
+// sources consulted when pulling images.
+func loadKeychainConfig(config *Config) error {
+	raw := getEnvOrDefault("REGISTRY_KEYCHAIN", defaultRegistryKeychain)
+
+	var keychain []string
+	for _, entry := range splitList(raw) {
+		helper, isHelper := strings.CutPrefix(entry, keychainHelperPrefix)
+		if entry != keychainProvider && entry != keychainDocker && (!isHelper || !credentialHelperName.MatchString(helper)) {
+			return fmt.Errorf("invalid REGISTRY_KEYCHAIN entry: %s (must be %s, %s or %s<name>)", entry, keychainProvider, keychainDocker, keychainHelperPrefix)
+		}
+		keychain = append(keychain, entry)
+	}
+	if len(keychain) == 0 {
+		return fmt.Errorf("REGISTRY_KEYCHAIN must name at least one credential source")
+	}
+
+	config.Keychain = keychain
+	return nil
+}
+
+// keychainFor builds the keychain for pulls from the sources in
+// config.Keychain. The first source with credentials for a registry wins;
+// registries no source knows are accessed anonymously.
+func keychainFor(ctx context.Context, config *Config, provider Provider) authn.Keychain {
+	entries := config.Keychain
+	if len(entries) == 0 {
+		entries = strings.Split(defaultRegistryKeychain, ",")
+	}
+
+	keychains := make([]authn.Keychain, 0, len(entries))
+	for _, entry := range entries {
+		switch {
+		case entry == keychainProvider:
+			keychains = append(keychains, providerKeychain{ctx: ctx, provider: provider})
+		case entry == keychainDocker:
+			keychains = append(keychains, authn.DefaultKeychain)
+		case strings.HasPrefix(entry, keychainHelperPrefix):
+			helper := execCredentialHelper{ctx: ctx, name: strings.TrimPrefix(entry, keychainHelperPrefix)}
+			keychains = append(keychains, authn.NewKeychainFromHelper(helper))
+		}
+	}
+
+	return authn.NewMultiKeychain(keychains...)
+}
+
+// orasCredential returns the ORAS credential function resolving registries
+// through keychainFor, so that pulls authenticate like tag listing.
+func orasCredential(config *Config, provider Provider) auth.CredentialFunc {
+	return func(ctx context.Context, registry string) (auth.Credential, error) {
+		var opts []name.Option
+		if isInsecureRegistry(config, registry) {
+			opts = append(opts, name.Insecure)
+		}
+		reg, err := name.NewRegistry(registry, opts...)
+		if err != nil {
+			return auth.EmptyCredential, fmt.Errorf("parsing registry %s: %w", registry, err)
+		}
+
+		authenticator, err := keychainFor(ctx, config, provider).Resolve(reg)
+		if err != nil {
+			return auth.EmptyCredential, err
+		}
+		cfg, err := authn.Authorization(ctx, authenticator)
+		if err != nil {
+			return auth.EmptyCredential, fmt.Errorf("getting credentials for %s: %w", registry, err)
+		}
+		return auth.Credential{
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			RefreshToken: cfg.IdentityToken,
+			AccessToken:  cfg.RegistryToken,
+		}, nil
+	}
+}
+
+// providerKeychain resolves the credentials returned by Provider.Credentials.
+type providerKeychain struct {
+	ctx      context.Context
+	provider Provider
+}
+
+func (k providerKeychain) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	cred, err := k.provider.Credentials(k.ctx, resource.RegistryStr())
+	if err != nil {
+		return nil, fmt.Errorf("getting credentials for %s: %w", resource.RegistryStr(), err)
+	}
+	return authenticatorFor(cred), nil
+}
+
+// errCredentialsNotFound is returned by execCredentialHelper.Get when the
+// helper stores no credentials for a registry.
+var errCredentialsNotFound = errors.New("credentials not found")
+
+// execCredentialHelper runs docker-credential-<name> using the Docker
+// credential helper protocol. The helper is killed once ctx is done.
+type execCredentialHelper struct {
+	ctx  context.Context
+	name string
+}
+
+// Get returns the credentials the helper stores for serverURL, or
+// errCredentialsNotFound for registries the helper does not know. Errors,
+// including errCredentialsNotFound, make the keychain fall through to the
+// next source.
+func (h execCredentialHelper) Get(serverURL string) (string, string, error) {
+	cmd := exec.CommandContext(h.ctx, "docker-credential-"+h.name, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers report unknown registries on stdout, e.g. "credentials not
+		// found in native keychain"
+		if strings.Contains(string(out), errCredentialsNotFound.Error()) {
+			return "", "", errCredentialsNotFound
+		}
+		return "", "", fmt.Errorf("docker-credential-%s: %v: %s", h.name, err, strings.TrimSpace(string(out)+stderr.String()))
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", fmt.Errorf("parsing docker-credential-%s output: %w", h.name, err)
+	}
+
+	return creds.Username, creds.Secret, nil
+}
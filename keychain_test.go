@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestLoadKeychainConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "default",
+			value: "",
+			want:  []string{"provider", "docker"},
+		},
+		{
+			name:  "custom order with helper",
+			value: "docker, helper:ecr-login,provider",
+			want:  []string{"docker", "helper:ecr-login", "provider"},
+		},
+		{
+			name:    "unknown source",
+			value:   "provider,vault",
+			wantErr: true,
+		},
+		{
+			name:    "helper without name",
+			value:   "helper:",
+			wantErr: true,
+		},
+		{
+			name:    "only separators",
+			value:   ",",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalGetEnvFunc := getEnvFunc
+			getEnvFunc = func(key string) string {
+				if key == "REGISTRY_KEYCHAIN" {
+					return tt.value
+				}
+				return ""
+			}
+			defer func() {
+				getEnvFunc = originalGetEnvFunc
+			}()
+
+			config := &Config{}
+			err := loadKeychainConfig(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadKeychainConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(config.Keychain) != len(tt.want) {
+				t.Fatalf("Keychain = %v, want %v", config.Keychain, tt.want)
+			}
+			for i := range tt.want {
+				if config.Keychain[i] != tt.want[i] {
+					t.Errorf("Keychain = %v, want %v", config.Keychain, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeychainFor(t *testing.T) {
+	// Docker config with credentials for both registries
+	dockerDir := t.TempDir()
+	dockerAuth := base64.StdEncoding.EncodeToString([]byte("docker-user:docker-pass"))
+	dockerConfig := `{"auths":{"ghcr.io":{"auth":"` + dockerAuth + `"},"registry.example.com":{"auth":"` + dockerAuth + `"}}}`
+	if err := os.WriteFile(filepath.Join(dockerDir, "config.json"), []byte(dockerConfig), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	t.Setenv("DOCKER_CONFIG", dockerDir)
+
+	// Standalone credential helper answering for helper.example.com only
+	helperDir := t.TempDir()
+	helper := "#!/bin/sh\nread server\nif [ \"$server\" = helper.example.com ]; then\n  echo '{\"Username\":\"helper-user\",\"Secret\":\"helper-pass\"}'\nelse\n  echo 'credentials not found in native keychain'\n  exit 1\nfi\n"
+	if err := os.WriteFile(filepath.Join(helperDir, "docker-credential-test"), []byte(helper), 0755); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	t.Setenv("PATH", helperDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	provider := mustGitHubProvider(t, &Config{ImageBase: "ghcr.io/owner/policies", GithubToken: "ghp_test"})
+
+	tests := []struct {
+		name     string
+		keychain []string
+		image    string
+		want     authn.AuthConfig
+	}{
+		{
+			name:  "provider credentials first by default",
+			image: "ghcr.io/owner/policies:v1",
+			want:  authn.AuthConfig{Username: githubTokenUsername, Password: "ghp_test"},
+		},
+		{
+			name:  "docker config for other registries",
+			image: "registry.example.com/team/policies:v1",
+			want:  authn.AuthConfig{Username: "docker-user", Password: "docker-pass"},
+		},
+		{
+			name:     "docker config first",
+			keychain: []string{"docker", "provider"},
+			image:    "ghcr.io/owner/policies:v1",
+			want:     authn.AuthConfig{Username: "docker-user", Password: "docker-pass"},
+		},
+		{
+			name:     "credential helper",
+			keychain: []string{"provider", "helper:test"},
+			image:    "helper.example.com/policies:v1",
+			want:     authn.AuthConfig{Username: "helper-user", Password: "helper-pass"},
+		},
+		{
+			name:     "anonymous when no source has credentials",
+			keychain: []string{"provider", "helper:test"},
+			image:    "registry.example.com/team/policies:v1",
+			want:     authn.AuthConfig{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := name.ParseReference(tt.image)
+			if err != nil {
+				t.Fatalf("ParseReference() error = %v", err)
+			}
+
+			kc := keychainFor(context.Background(), &Config{Keychain: tt.keychain}, provider)
+			auth, err := kc.Resolve(ref.Context())
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			got, err := auth.Authorization()
+			if err != nil {
+				t.Fatalf("Authorization() error = %v", err)
+			}
+			if got.Username != tt.want.Username || got.Password != tt.want.Password {
+				t.Errorf("Authorization() = %s/%s, want %s/%s", got.Username, got.Password, tt.want.Username, tt.want.Password)
+			}
+
+			// ORAS pulls resolve credentials through the same chain
+			cred, err := orasCredential(&Config{Keychain: tt.keychain}, provider)(context.Background(), ref.Context().RegistryStr())
+			if err != nil {
+				t.Fatalf("orasCredential() error = %v", err)
+			}
+			if cred.Username != tt.want.Username || cred.Password != tt.want.Password {
+				t.Errorf("orasCredential() = %s/%s, want %s/%s", cred.Username, cred.Password, tt.want.Username, tt.want.Password)
+			}
+		})
+	}
+}
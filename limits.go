@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	defaultMaxLayerSize    = 16 << 20
+	defaultMaxArtifactSize = 64 << 20
+	defaultMaxFiles        = 1000
+)
+
+// errPullLimit is returned when an artifact exceeds MAX_LAYER_SIZE,
+// MAX_ARTIFACT_SIZE or MAX_FILES. The version is then not applied.
+var errPullLimit = errors.New("pull limit exceeded")
+
+// loadLimitsConfig reads MAX_LAYER_SIZE, MAX_ARTIFACT_SIZE and MAX_FILES,
+// which bound what a single pull may write to disk.
+func loadLimitsConfig(config *Config) error {
+	var err error
+	if config.MaxLayerSize, err = sizeEnv("MAX_LAYER_SIZE", defaultMaxLayerSize); err != nil {
+		return err
+	}
+	if config.MaxArtifactSize, err = sizeEnv("MAX_ARTIFACT_SIZE", defaultMaxArtifactSize); err != nil {
+		return err
+	}
+
+	config.MaxFiles = defaultMaxFiles
+	if raw := strings.TrimSpace(getEnvFunc("MAX_FILES")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid MAX_FILES: %s (must be a positive number)", raw)
+		}
+		config.MaxFiles = n
+	}
+
+	return nil
+}
+
+// sizeEnv reads a size in bytes, optionally with a Ki, Mi or Gi suffix.
+func sizeEnv(key string, defaultValue int64) (int64, error) {
+	raw := strings.TrimSpace(getEnvFunc(key))
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	size, err := parseSize(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s (must be a number of bytes, optionally with a Ki, Mi or Gi suffix)", key, raw)
+	}
+	return size, nil
+}
+
+func parseSize(s string) (int64, error) {
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30} {
+		if trimmed, ok := strings.CutSuffix(s, suffix); ok {
+			s, multiplier = trimmed, m
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, errors.New("size must be positive")
+	}
+	return n * multiplier, nil
+}
+
+// pullLimits tracks the bytes and files written by one pull against the
+// configured limits.
+type pullLimits struct {
+	maxLayerSize    int64
+	maxArtifactSize int64
+	maxFiles        int
+
+	written int64
+	files   int
+}
+
+func newPullLimits(config *Config) *pullLimits {
+	l := &pullLimits{
+		maxLayerSize:    config.MaxLayerSize,
+		maxArtifactSize: config.MaxArtifactSize,
+		maxFiles:        config.MaxFiles,
+	}
+	// Configs built without loadLimitsConfig still get the defaults
+	if l.maxLayerSize <= 0 {
+		l.maxLayerSize = defaultMaxLayerSize
+	}
+	if l.maxArtifactSize <= 0 {
+		l.maxArtifactSize = defaultMaxArtifactSize
+	}
+	if l.maxFiles <= 0 {
+		l.maxFiles = defaultMaxFiles
+	}
+	return l
+}
+
+// checkLayer rejects a layer by the size declared in the manifest before it
+// is downloaded.
+func (l *pullLimits) checkLayer(name string, size int64) error {
+	if size > l.maxLayerSize {
+		return fmt.Errorf("%w: %s is %d bytes, MAX_LAYER_SIZE is %d", errPullLimit, name, size, l.maxLayerSize)
+	}
+	if l.written+size > l.maxArtifactSize {
+		return fmt.Errorf("%w: %s would bring the artifact to %d bytes, MAX_ARTIFACT_SIZE is %d", errPullLimit, name, l.written+size, l.maxArtifactSize)
+	}
+	return nil
+}
+
+// addFile counts a file written by the pull against MAX_FILES.
+func (l *pullLimits) addFile(name string) error {
+	if l.files >= l.maxFiles {
+		return fmt.Errorf("%w: %s would be file %d, MAX_FILES is %d", errPullLimit, name, l.files+1, l.maxFiles)
+	}
+	l.files++
+	return nil
+}
+
+// layerReader returns a reader for the content of one layer that fails
+// once the layer or the whole artifact grows past its limit, so that a
+// layer larger than declared cannot exhaust the disk or memory.
+func (l *pullLimits) layerReader(name string, r io.Reader) io.Reader {
+	return &limitedLayerReader{limits: l, name: name, r: r}
+}
+
+type limitedLayerReader struct {
+	limits *pullLimits
+	name   string
+	r      io.Reader
+	read   int64
+}
+
+func (lr *limitedLayerReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.read += int64(n)
+	lr.limits.written += int64(n)
+
+	if lr.read > lr.limits.maxLayerSize {
+		return n, fmt.Errorf("%w: %s exceeds MAX_LAYER_SIZE of %d bytes", errPullLimit, lr.name, lr.limits.maxLayerSize)
+	}
+	if lr.limits.written > lr.limits.maxArtifactSize {
+		return n, fmt.Errorf("%w: artifact exceeds MAX_ARTIFACT_SIZE of %d bytes at %s", errPullLimit, lr.limits.maxArtifactSize, lr.name)
+	}
+	return n, err
+}
+
+// orasPreCopy enforces the limits on the blobs fetched by oras.Copy. oras
+// verifies every blob against its descriptor, so the declared sizes hold.
+func (l *pullLimits) orasPreCopy(ctx context.Context, desc ocispec.Descriptor) error {
+	name := desc.Annotations[ocispec.AnnotationTitle]
+	if name == "" {
+		name = desc.Digest.String()
+	}
+
+	if err := l.checkLayer(name, desc.Size); err != nil {
+		return err
+	}
+	// Titled archives are unpacked after the copy and count by their content
+	if desc.Annotations[ocispec.AnnotationTitle] != "" && isArchiveLayer(desc.MediaType) {
+		return nil
+	}
+	// Only titled blobs are written out as files by the file store
+	if desc.Annotations[ocispec.AnnotationTitle] != "" {
+		if err := l.addFile(name); err != nil {
+			return err
+		}
+	}
+	l.written += desc.Size
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadLimitsConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		env              map[string]string
+		wantLayerSize    int64
+		wantArtifactSize int64
+		wantFiles        int
+		errContains      string
+	}{
+		{
+			name:             "defaults",
+			env:              map[string]string{},
+			wantLayerSize:    defaultMaxLayerSize,
+			wantArtifactSize: defaultMaxArtifactSize,
+			wantFiles:        defaultMaxFiles,
+		},
+		{
+			name:             "suffixes",
+			env:              map[string]string{"MAX_LAYER_SIZE": "512Ki", "MAX_ARTIFACT_SIZE": "2Mi", "MAX_FILES": "10"},
+			wantLayerSize:    512 << 10,
+			wantArtifactSize: 2 << 20,
+			wantFiles:        10,
+		},
+		{
+			name:             "plain bytes",
+			env:              map[string]string{"MAX_LAYER_SIZE": "4096", "MAX_ARTIFACT_SIZE": "1Gi"},
+			wantLayerSize:    4096,
+			wantArtifactSize: 1 << 30,
+			wantFiles:        defaultMaxFiles,
+		},
+		{
+			name:        "invalid size",
+			env:         map[string]string{"MAX_LAYER_SIZE": "10MB"},
+			errContains: "invalid MAX_LAYER_SIZE",
+		},
+		{
+			name:        "zero size",
+			env:         map[string]string{"MAX_ARTIFACT_SIZE": "0"},
+			errContains: "invalid MAX_ARTIFACT_SIZE",
+		},
+		{
+			name:        "invalid file count",
+			env:         map[string]string{"MAX_FILES": "-1"},
+			errContains: "invalid MAX_FILES",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalGetEnvFunc := getEnvFunc
+			getEnvFunc = func(key string) string {
+				return tt.env[key]
+			}
+			defer func() {
+				getEnvFunc = originalGetEnvFunc
+			}()
+
+			config := &Config{}
+			err := loadLimitsConfig(config)
+			if tt.errContains != "" {
+				if err == nil || !contains(err.Error(), tt.errContains) {
+					t.Errorf("loadLimitsConfig() error = %v, want to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadLimitsConfig() error = %v", err)
+			}
+			if config.MaxLayerSize != tt.wantLayerSize || config.MaxArtifactSize != tt.wantArtifactSize || config.MaxFiles != tt.wantFiles {
+				t.Errorf("limits = %d/%d/%d, want %d/%d/%d", config.MaxLayerSize, config.MaxArtifactSize, config.MaxFiles,
+					tt.wantLayerSize, tt.wantArtifactSize, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestExtractImageLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		docs        []string
+		errContains string
+	}{
+		{
+			name:   "within limits",
+			config: Config{MaxLayerSize: 1024, MaxArtifactSize: 4096, MaxFiles: 3},
+			docs:   []string{testPolicyYAML, testPolicyYAML, testPolicyYAML},
+		},
+		{
+			name:        "layer too large",
+			config:      Config{MaxLayerSize: 32},
+			docs:        []string{testPolicyYAML},
+			errContains: "MAX_LAYER_SIZE",
+		},
+		{
+			name:        "artifact too large",
+			config:      Config{MaxArtifactSize: int64(2*len(testPolicyYAML) + 1)},
+			docs:        []string{testPolicyYAML, testPolicyYAML, testPolicyYAML},
+			errContains: "MAX_ARTIFACT_SIZE",
+		},
+		{
+			name:        "too many files",
+			config:      Config{MaxFiles: 2},
+			docs:        []string{testPolicyYAML, testPolicyYAML, testPolicyYAML},
+			errContains: "MAX_FILES",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := extractImage(&tt.config, newPolicyImage(t, tt.docs...), dir)
+			if tt.errContains == "" {
+				if err != nil {
+					t.Fatalf("extractImage() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, errPullLimit) || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("extractImage() error = %v, want a pull limit error mentioning %s", err, tt.errContains)
+			}
+		})
+	}
+}
+
+func TestLayerReaderEnforcesLimitWhileStreaming(t *testing.T) {
+	// A layer delivering more than its declared size is cut off
+	limits := newPullLimits(&Config{MaxLayerSize: 1024})
+	path := filepath.Join(t.TempDir(), "layer-0.yaml")
+	_, err := writeLimitedFile(path, limits.layerReader("layer 0", strings.NewReader(strings.Repeat("a", 4096))))
+	if !errors.Is(err, errPullLimit) {
+		t.Fatalf("writeLimitedFile() error = %v, want a pull limit error", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("partial file left behind: %v", err)
+	}
+
+	// The artifact limit spans layers
+	limits = newPullLimits(&Config{MaxLayerSize: 1024, MaxArtifactSize: 1536})
+	if _, err := io.Copy(io.Discard, limits.layerReader("layer 0", strings.NewReader(strings.Repeat("a", 1024)))); err != nil {
+		t.Fatalf("first layer error = %v", err)
+	}
+	if _, err := io.Copy(io.Discard, limits.layerReader("layer 1", strings.NewReader(strings.Repeat("a", 1024)))); !errors.Is(err, errPullLimit) {
+		t.Errorf("second layer error = %v, want a pull limit error", err)
+	}
+}
+
+func TestWatchLoopAbortsOnPullLimit(t *testing.T) {
+	originalApplyManifestsFunc := applyManifestsFunc
+	applied := false
+	applyManifestsFunc = func(config *Config, dir string) error {
+		applied = true
+		return nil
+	}
+	defer func() {
+		applyManifestsFunc = originalApplyManifestsFunc
+	}()
+
+	dir := t.TempDir()
+	appendLayoutImage(t, dir, "v1.0.0", testPolicyYAML)
+
+	stateDir := t.TempDir()
+	config := &Config{
+		Name:         "limits-test",
+		Provider:     "layout",
+		ImageBase:    dir,
+		StateDir:     stateDir,
+		LastFile:     filepath.Join(stateDir, "last_seen"),
+		MaxLayerSize: 16,
+	}
+
+	err := watchLoop(context.Background(), config)
+	if !errors.Is(err, errPullLimit) {
+		t.Fatalf("watchLoop() error = %v, want a pull limit error", err)
+	}
+	if applied {
+		t.Error("manifests were applied despite the pull limit")
+	}
+	if _, err := os.Stat(config.LastFile); !os.IsNotExist(err) {
+		t.Errorf("state written despite the pull limit: %v", err)
+	}
+	if _, err := os.Stat("/tmp/image-limits-test-v1.0.0"); !os.IsNotExist(err) {
+		t.Errorf("partial pull left behind: %v", err)
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,12 +11,14 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/bitfield/script"
-	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"oras.land/oras-go/v2"
 	"oras.land/oras-go/v2/content/file"
 	orasremote "oras.land/oras-go/v2/registry/remote"
@@ -42,6 +44,8 @@ var (
 	applyManifestsFunc = applyManifestsReal
 	// pullImageToDirFunc can be overridden in tests
 	pullImageToDirFunc = pullImageToDirReal
+	// resolveDigestFunc can be overridden in tests
+	resolveDigestFunc = resolveDigest
 	// stateDirBase can be overridden in tests to avoid creating /tmp/kyverno-watcher
 	stateDirBase = "/tmp/kyverno-watcher"
 )
@@ -54,28 +58,104 @@ type Manifest struct {
 }
 
 type ManifestMetadata struct {
-	Name      string            `yaml:"name" json:"name"`
-	Namespace string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
-	Labels    map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Name        string            `yaml:"name" json:"name"`
+	Namespace   string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
 }
 
 type Config struct {
-	GithubToken        string
-	ImageBase          string
-	Owner              string
-	Package            string
-	PackageNormalized  string
-	PollInterval       int
+	// Name identifies the source when several are configured via SOURCES_FILE
+	Name        string
+	GithubToken string
+	ImageBase   string
+	// ImageRegistry, ImageRepository, ImageTag and ImageDigest are parsed
+	// from IMAGE_BASE for registry providers; tag and digest are only set
+	// when written in IMAGE_BASE
+	ImageRegistry     string
+	ImageRepository   string
+	ImageTag          string
+	ImageDigest       string
+	Owner             string
+	Package           string
+	PackageNormalized string
+	PollInterval      int
+	// SyncTimeout bounds a single sync in seconds, so a hung registry
+	// cannot hold its parallelism slot
+	SyncTimeout        int
 	GithubAPIOwnerType string
 	StateDir           string
 	LastFile           string
 	Provider           string
 	Username           string
 	Password           string
+	TagOrder           string
+	VersionConstraint  string
+	IncludePrerelease  bool
+	TagIncludeRegex    string
+	TagExcludeRegex    string
+
+	GithubAPIURL            string
+	GithubAppID             string
+	GithubAppInstallationID string
+	GithubAppPrivateKeyFile string
+
+	// Keychain lists the credential sources consulted for pulls, in order
+	Keychain []string
+
+	GitBranch     string
+	GitTagPattern string
+	GitPath       string
+
+	WebhookAddr   string
+	WebhookSecret string
+
+	ArtifactoryDiscovery  string
+	ArtifactoryURL        string
+	ArtifactoryRepository string
+	// ArtifactoryDockerConfig and ArtifactoryCredentialHelper are
+	// alternative credential sources to Username/Password
+	ArtifactoryDockerConfig     string
+	ArtifactoryCredentialHelper string
+
+	// MaxLayerSize, MaxArtifactSize and MaxFiles bound what a single pull
+	// may write to disk
+	MaxLayerSize    int64
+	MaxArtifactSize int64
+	MaxFiles        int
+
+	// LayerMediaTypes and ArtifactTypes restrict what is extracted from a
+	// pulled artifact
+	LayerMediaTypes []string
+	ArtifactTypes   []string
+
+	// IndexSelector chooses the child manifest of an image index by
+	// annotation or "platform"
+	IndexSelector map[string]string
+
+	// Mirrors lists the registries tried when the registry of IMAGE_BASE
+	// is unavailable, in order
+	Mirrors []string
+
+	// TLS, insecure registry and proxy settings of every outbound client;
+	// transport is built from them by loadTransportConfig
+	TLSCAFiles         []string
+	TLSClientCertFile  string
+	TLSClientKeyFile   string
+	InsecureRegistries []string
+	HTTPProxy          string
+	HTTPSProxy         string
+	NoProxy            string
+	transport          http.RoundTripper
+
+	// provider is built lazily by providerFor and reused across polls
+	provider Provider
 }
 
 type GitHubPackageVersion struct {
-	ID        int64     `json:"id"`
+	ID int64 `json:"id"`
+	// Name holds the manifest digest (sha256:...) for container packages
+	Name      string    `json:"name"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Metadata  struct {
 		Container struct {
@@ -88,167 +168,163 @@ func main() {
 	// Print version
 	log.Printf("Kyverno Artifact Watcher version %s\n", Version)
 
-	config := loadConfig()
+	sources := loadSources()
 
-	if config.Provider == "github" {
-		log.Printf("Starting GHCR watcher for %s (owner=%s, package=%s)\n",
-			config.ImageBase, config.Owner, config.Package)
-	} else {
-		log.Printf("Starting Artifactory watcher for %s\n", config.ImageBase)
+	for _, src := range sources {
+		provider, err := providerFor(src.config)
+		if err != nil {
+			logFatal(err)
+		}
+		log.Printf("Starting %s watcher for %s%s\n", provider.Name(), src.config.ImageBase, src.config.logSuffix())
 	}
 
-	for {
-		if err := watchLoop(config); err != nil {
-			log.Printf("Error in watch loop: %v\n", err)
-		}
-		time.Sleep(time.Duration(config.PollInterval) * time.Second)
+	// Webhook settings are process wide and therefore the same for every source
+	if webhook := sources[0].config; webhook.WebhookAddr != "" {
+		go func() {
+			logFatal(fmt.Sprintf("Webhook server failed: %v", serveWebhooks(webhook.WebhookAddr, webhook.WebhookSecret, sources)))
+		}()
 	}
+
+	runSources(sources, sourceParallelism(), nil)
 }
 
 // getEnvFunc can be overridden in tests
 var getEnvFunc = os.Getenv
 
+// fatalMessage capitalises a configuration error for logFatal.
+func fatalMessage(err error) string {
+	msg := err.Error()
+	r, size := utf8.DecodeRuneInString(msg)
+	return string(unicode.ToUpper(r)) + msg[size:]
+}
+
 func loadConfig() *Config {
-	provider := strings.ToLower(getEnvOrDefault("PROVIDER", "github"))
+	return loadSourceConfig("")
+}
 
-	var githubToken, username, password string
-	var owner, packageName string
+// loadSourceConfig loads the configuration of a watched artifact. Named
+// sources keep their state in a subdirectory of the state directory.
+func loadSourceConfig(sourceName string) *Config {
+	provider := strings.ToLower(getEnvOrDefault("PROVIDER", "github"))
 
 	imageBase := getEnvFunc("IMAGE_BASE")
 	if imageBase == "" {
 		logFatal("IMAGE_BASE environment variable must be set (e.g., ghcr.io/owner/package)")
 	}
 
-	switch provider {
-	case "github":
-		githubToken = strings.TrimSpace(getEnvFunc("GITHUB_TOKEN"))
-		if githubToken == "" {
-			logFatal("GITHUB_TOKEN environment variable must be set")
-		}
-
-		// Validate token format - GitHub tokens should only contain alphanumeric and underscores
-		// Classic tokens start with ghp_, fine-grained with github_pat_
-		// Remove any non-printable characters that might cause header issues
-		githubToken = strings.Map(func(r rune) rune {
-			if r < 32 || r > 126 {
-				return -1 // Remove non-printable ASCII
-			}
-			return r
-		}, githubToken)
-
-		if githubToken == "" {
-			logFatal("GITHUB_TOKEN contains only invalid characters")
-		}
-
-		// Log token prefix for debugging (don't log full token)
-		tokenPrefix := githubToken
-		if len(tokenPrefix) > 10 {
-			tokenPrefix = tokenPrefix[:10] + "..."
-		}
-		log.Printf("Using GitHub token: %s (length: %d)\n", tokenPrefix, len(githubToken))
+	reg, err := lookupProvider(provider)
+	if err != nil {
+		logFatal(fatalMessage(err))
+	}
 
-		// Parse IMAGE_BASE to extract owner and package
-		// Expected format: ghcr.io/owner/package or ghcr.io/owner/package:tag
-		var err error
-		owner, packageName, err = parseImageBase(imageBase)
-		if err != nil {
-			logFatal(fmt.Sprintf("Failed to parse IMAGE_BASE: %v", err))
-		}
-	case "artifactory":
-		username = strings.TrimSpace(getEnvFunc("ARTIFACTORY_USERNAME"))
-		password = strings.TrimSpace(getEnvFunc("ARTIFACTORY_PASSWORD"))
-		if username == "" || password == "" {
-			logFatal("ARTIFACTORY_USERNAME and ARTIFACTORY_PASSWORD environment variables must be set for artifactory provider")
-		}
-		log.Printf("Using Artifactory with username: %s\n", username)
-	default:
-		logFatal(fmt.Sprintf("Unsupported PROVIDER: %s (must be 'github' or 'artifactory')", provider))
+	stateDir := stateDirBase
+	if sourceName != "" {
+		stateDir = filepath.Join(stateDirBase, sourceName)
+	}
+	config := &Config{
+		Name:         sourceName,
+		ImageBase:    imageBase,
+		PollInterval: getEnvAsIntOrDefault("POLL_INTERVAL", 30),
+		SyncTimeout:  getEnvAsIntOrDefault("SYNC_TIMEOUT", defaultSyncTimeout),
+		StateDir:     stateDir,
+		LastFile:     filepath.Join(stateDir, "last_seen"),
+		Provider:     provider,
 	}
 
-	pollInterval := getEnvAsIntOrDefault("POLL_INTERVAL", 30)
-	githubAPIOwnerType := getEnvOrDefault("GITHUB_API_OWNER_TYPE", "users")
+	if err := reg.configure(config); err != nil {
+		logFatal(fatalMessage(err))
+	}
 
-	// Normalize package name for API path
-	packageNormalized := strings.ReplaceAll(packageName, "/", "%2F")
+	if err := loadTagFilters(config); err != nil {
+		logFatal(fatalMessage(err))
+	}
+	if err := loadTransportConfig(config); err != nil {
+		logFatal(fatalMessage(err))
+	}
+	if err := loadMirrorConfig(config); err != nil {
+		logFatal(fatalMessage(err))
+	}
+	if err := loadLimitsConfig(config); err != nil {
+		logFatal(fatalMessage(err))
+	}
+	if err := loadMediaTypeConfig(config); err != nil {
+		logFatal(fatalMessage(err))
+	}
+	if err := loadIndexSelector(config); err != nil {
+		logFatal(fatalMessage(err))
+	}
+	if err := loadKeychainConfig(config); err != nil {
+		logFatal(fatalMessage(err))
+	}
+	if err := loadWebhookConfig(config); err != nil {
+		logFatal(fatalMessage(err))
+	}
+	if config.VersionConstraint != "" && config.TagOrder != "" && config.TagOrder != TagOrderSemver {
+		logFatal(fmt.Sprintf("VERSION_CONSTRAINT requires TAG_ORDER=%s, got %s", TagOrderSemver, config.TagOrder))
+	}
 
-	stateDir := stateDirBase
 	if err := os.MkdirAll(stateDir, 0755); err != nil {
 		logFatal(fmt.Sprintf("Failed to create state directory: %v", err))
 	}
-	lastFile := filepath.Join(stateDir, "last_seen")
-
-	return &Config{
-		GithubToken:        githubToken,
-		ImageBase:          imageBase,
-		Owner:              owner,
-		Package:            packageName,
-		PackageNormalized:  packageNormalized,
-		PollInterval:       pollInterval,
-		GithubAPIOwnerType: githubAPIOwnerType,
-		StateDir:           stateDir,
-		LastFile:           lastFile,
-		Provider:           provider,
-		Username:           username,
-		Password:           password,
-	}
-}
 
-func parseImageBase(imageBase string) (owner, packageName string, err error) {
-	// Remove tag if present (e.g., ghcr.io/owner/package:v0.0.1 -> ghcr.io/owner/package)
-	imageBase = strings.Split(imageBase, ":")[0]
+	return config
+}
 
-	// Expected format: ghcr.io/owner/package[/subpackage/...]
-	parts := strings.Split(imageBase, "/")
-	if len(parts) < 3 {
-		return "", "", fmt.Errorf("IMAGE_BASE must be in format ghcr.io/owner/package, got: %s", imageBase)
+func watchLoop(ctx context.Context, config *Config) error {
+	provider, err := providerFor(config)
+	if err != nil {
+		return err
 	}
 
-	// parts[0] = ghcr.io
-	// parts[1] = owner
-	// parts[2:] = package parts
-	owner = parts[1]
-	packageName = strings.Join(parts[2:], "/")
-
-	if owner == "" || packageName == "" {
-		return "", "", fmt.Errorf("could not extract owner and package from IMAGE_BASE: %s", imageBase)
+	latest, err := provider.LatestVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("could not determine latest tag/digest: %w", err)
 	}
 
-	return owner, packageName, nil
-}
+	if latest == "" {
+		log.Println("No versions found for package")
+		return nil
+	}
 
-func watchLoop(config *Config) error {
-	var latest string
-	var err error
+	ref, err := provider.Reference(latest)
+	if err != nil {
+		return fmt.Errorf("resolving reference for %s: %w", latest, err)
+	}
 
-	if config.Provider == "github" {
-		latest, err = getLatestTagOrDigest(config)
-		if err != nil {
-			return fmt.Errorf("could not determine latest tag/digest: %w", err)
-		}
+	current := State{Tag: latest}
+	var fromMirror bool
+	current.Digest, fromMirror, err = resolveDigestFunc(ctx, config, ref)
+	if err != nil {
+		log.Printf("Warning: could not resolve digest of %s, comparing tags only: %v\n", ref, err)
+	}
 
-		if latest == "" {
-			log.Println("No versions found for package")
-			return nil
-		}
-	} else {
-		// For artifactory, we use the image base as-is with the provided tag
-		// The user specifies the full image reference including tag
-		parts := strings.Split(config.ImageBase, ":")
-		if len(parts) < 2 {
-			return fmt.Errorf("IMAGE_BASE for artifactory must include a tag (e.g., registry/path:tag)")
-		}
-		latest = parts[len(parts)-1]
+	prev, err := readState(config.LastFile)
+	if err != nil {
+		log.Printf("Warning: %v\n", err)
 	}
 
-	prev, _ := os.ReadFile(config.LastFile)
-	prevTag := strings.TrimSpace(string(prev))
+	// Mirrors may lag behind, so only the registry itself can move a tag
+	// that was already applied to other content
+	if fromMirror && prev.Tag == current.Tag && prev.Digest != "" && prev.Digest != current.Digest {
+		log.Printf("Warning: mirror reports %s for %s, keeping %s until the registry is reachable\n", current.Digest, latest, prev.Digest)
+		return nil
+	}
 
-	if latest != prevTag {
-		log.Printf("Detected change: previous='%s' new='%s'\n", prevTag, latest)
+	if prev.Changed(current) {
+		log.Printf("Detected change: previous='%s' new='%s'\n", prev, current)
 
 		destDir := fmt.Sprintf("/tmp/image-%s", sanitizePath(latest))
+		if config.Name != "" {
+			destDir = fmt.Sprintf("/tmp/image-%s-%s", config.Name, sanitizePath(latest))
+		}
 
-		if err := pullImageToDirFunc(config, latest, destDir); err != nil {
+		if err := pullImageToDirFunc(ctx, config, latest, destDir); err != nil {
+			// Never leave a partially extracted oversized artifact behind
+			if errors.Is(err, errPullLimit) {
+				if rerr := os.RemoveAll(destDir); rerr != nil {
+					log.Printf("Warning: failed to remove directory %s: %v", destDir, rerr)
+				}
+			}
 			return fmt.Errorf("pull failed: %w", err)
 		}
 
@@ -256,95 +332,52 @@ func watchLoop(config *Config) error {
 			return fmt.Errorf("apply manifests failed: %w", err)
 		}
 
-		if err := os.WriteFile(config.LastFile, []byte(latest), 0644); err != nil {
+		if err := writeState(config.LastFile, current); err != nil {
 			return fmt.Errorf("failed to write last file: %w", err)
 		}
 	} else {
-		log.Printf("No change (latest=%s)\n", latest)
+		log.Printf("No change (latest=%s)\n", current)
 	}
 
 	return nil
 }
 
-func getLatestTagOrDigest(config *Config) (string, error) {
-	apiURL := fmt.Sprintf("https://api.github.com/%s/%s/packages/container/%s/versions",
-		config.GithubAPIOwnerType, config.Owner, config.PackageNormalized)
-
-	req, err := http.NewRequest("GET", apiURL, nil)
+// resolveDigest returns the manifest digest imageRef currently points to,
+// using a HEAD request so that polling does not download the manifest.
+// fromMirror reports that the registry failed and the mirrors answered.
+func resolveDigest(ctx context.Context, config *Config, imageRef string) (digest string, fromMirror bool, err error) {
+	provider, err := providerFor(config)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", false, err
 	}
-
-	req.Header.Set("Authorization", "token "+config.GithubToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to make API request: %w", err)
+	if resolver, ok := provider.(DigestResolver); ok {
+		digest, err := resolver.Digest(ctx, imageRef)
+		return digest, false, err
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Warning: failed to close response body: %v", err)
-		}
-	}()
 
-	body, err := io.ReadAll(resp.Body)
+	ref, err := parseReference(config, imageRef)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
-	}
-
-	// Check for non-200 status codes
-	if resp.StatusCode != http.StatusOK {
-		var errMsg struct {
-			Message string `json:"message"`
-		}
-		_ = json.Unmarshal(body, &errMsg)
-
-		switch resp.StatusCode {
-		case http.StatusUnauthorized:
-			return "", fmt.Errorf("authentication failed (401): invalid or expired GITHUB_TOKEN")
-		case http.StatusForbidden:
-			return "", fmt.Errorf("access forbidden (403): token may lack required permissions (read:packages). Message: %s", errMsg.Message)
-		case http.StatusNotFound:
-			return "", fmt.Errorf("package not found (404): owner=%s, package=%s (owner type: %s). Verify package exists and token has access",
-				config.Owner, config.Package, config.GithubAPIOwnerType)
-		default:
-			return "", fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, errMsg.Message)
-		}
-	}
-
-	var versions []GitHubPackageVersion
-	if err := json.Unmarshal(body, &versions); err != nil {
-		return "", fmt.Errorf("failed to parse GitHub API response: %w. Response body: %s", err, string(body))
+		return "", false, fmt.Errorf("parsing image reference: %w", err)
 	}
 
-	if len(versions) == 0 {
-		return "", nil
-	}
-
-	// Find the most recently updated version
-	latest := versions[0]
-	for _, v := range versions {
-		if v.UpdatedAt.After(latest.UpdatedAt) {
-			latest = v
+	desc, err := remote.Head(ref, remoteOptions(ctx, config, provider)...)
+	if err != nil {
+		if len(config.Mirrors) > 0 {
+			log.Printf("Warning: HEAD %s failed, asking mirrors: %v\n", ref.Name(), err)
+			digest, err := mirrorDigest(ctx, config, provider, ref)
+			return digest, err == nil, err
 		}
+		return "", false, fmt.Errorf("HEAD %s: %w", ref.Name(), err)
 	}
 
-	// Prefer tag names if present
-	if len(latest.Metadata.Container.Tags) > 0 {
-		return latest.Metadata.Container.Tags[0], nil
-	}
-
-	// Fallback to version ID
-	return fmt.Sprintf("version-id-%d", latest.ID), nil
+	return desc.Digest.String(), false, nil
 }
 
-func pullImageToDir(config *Config, tag, destDir string) error {
-	return pullImageToDirFunc(config, tag, destDir)
+func pullImageToDir(ctx context.Context, config *Config, tag, destDir string) error {
+	return pullImageToDirFunc(ctx, config, tag, destDir)
 }
 
-func pullImageToDirReal(config *Config, tag, destDir string) error {
+func pullImageToDirReal(ctx context.Context, config *Config, tag, destDir string) error {
 	if err := os.RemoveAll(destDir); err != nil {
 		log.Printf("Warning: failed to remove directory %s: %v", destDir, err)
 	}
@@ -352,19 +385,25 @@ func pullImageToDirReal(config *Config, tag, destDir string) error {
 		return err
 	}
 
-	if config.Provider == "artifactory" {
-		log.Printf("Pulling image %s into %s using oras...\n", config.ImageBase, destDir)
-		if err := pullWithOras(config, destDir); err != nil {
-			return fmt.Errorf("oras pull failed: %w", err)
+	provider, err := providerFor(config)
+	if err != nil {
+		return err
+	}
+
+	imageRef, err := provider.Reference(tag)
+	if err != nil {
+		return fmt.Errorf("resolving reference for %s: %w", tag, err)
+	}
+
+	if puller, ok := provider.(Puller); ok {
+		if err := puller.Pull(ctx, imageRef, destDir); err != nil {
+			return err
 		}
 	} else {
-		log.Printf("Pulling image %s:%s into %s ...\n", config.ImageBase, tag, destDir)
+		log.Printf("Pulling image %s into %s ...\n", imageRef, destDir)
 
 		// Pull using OCI library
-		imageRef := fmt.Sprintf("%s:%s", config.ImageBase, tag)
-		ctx := context.Background()
-
-		if err := pullOCI(ctx, imageRef, destDir); err != nil {
+		if err := pullOCI(ctx, config, provider, imageRef, destDir); err != nil {
 			return fmt.Errorf("OCI pull failed: %w", err)
 		}
 	}
@@ -386,14 +425,50 @@ func pullImageToDirReal(config *Config, tag, destDir string) error {
 	return nil
 }
 
-func pullWithOras(config *Config, destDir string) error {
-	return orasPullFunc(config, destDir)
+// orasCopy copies the artifact ref points to into the file store, unpacking
+// its archive layers in destDir.
+func orasCopy(ctx context.Context, config *Config, provider Provider, ref name.Reference, fs *file.Store, destDir string) error {
+	// Create repository
+	repo, err := orasremote.NewRepository(ref.Context().Name())
+	if err != nil {
+		return fmt.Errorf("failed to create repository: %w", err)
+	}
+
+	repo.PlainHTTP = isInsecureRegistry(config, ref.Context().RegistryStr())
+
+	// Set up authentication through REGISTRY_KEYCHAIN
+	repo.Client = &auth.Client{
+		Client:     &http.Client{Transport: retry.NewTransport(httpTransport(config))},
+		Cache:      auth.NewCache(),
+		Credential: orasCredential(config, provider),
+	}
+
+	// Walk image indexes down to the selected manifest
+	desc, err := repo.Resolve(ctx, ref.Identifier())
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", ref.Name(), err)
+	}
+	if desc, err = orasSelectManifest(ctx, config, repo, desc); err != nil {
+		return err
+	}
+
+	// Copy from repository to file store
+	copyOpts := oras.DefaultCopyGraphOptions
+	copyOpts.Concurrency = 1
+	limits := newPullLimits(config)
+	copyOpts.PreCopy = limits.orasPreCopy
+	copyOpts.PostCopy = orasUnpackArchives(destDir, limits)
+	copyOpts.FindSuccessors = orasFindSuccessors(config)
+
+	return oras.CopyGraph(ctx, repo, fs, desc, copyOpts)
 }
 
-func orasPull(config *Config, destDir string) error {
-	log.Printf("Pulling %s to %s using ORAS library\n", config.ImageBase, destDir)
+func pullWithOras(ctx context.Context, config *Config, ref, destDir string) error {
+	return orasPullFunc(ctx, config, ref, destDir)
+}
 
-	ctx := context.Background()
+func orasPull(ctx context.Context, config *Config, ref, destDir string) error {
+	log.Printf("Pulling %s to %s using ORAS library\n", ref, destDir)
 
 	// Create file store for the destination
 	fs, err := file.New(destDir)
@@ -406,38 +481,29 @@ func orasPull(config *Config, destDir string) error {
 		}
 	}()
 
-	// Parse the image reference to get tag
-	ref := config.ImageBase
-
-	// Create repository
-	repo, err := orasremote.NewRepository(ref)
+	provider, err := providerFor(config)
 	if err != nil {
-		return fmt.Errorf("failed to create repository: %w", err)
+		return err
 	}
 
-	// Set up authentication with static credentials
-	repo.Client = &auth.Client{
-		Client: retry.DefaultClient,
-		Cache:  auth.NewCache(),
-		Credential: func(ctx context.Context, registry string) (auth.Credential, error) {
-			return auth.Credential{
-				Username: config.Username,
-				Password: config.Password,
-			}, nil
-		},
+	parsed, err := parseReference(config, ref)
+	if err != nil {
+		return fmt.Errorf("parsing image reference: %w", err)
 	}
-
-	// Get the tag from the reference
-	tag := ref
-	if idx := strings.LastIndex(ref, ":"); idx > 0 {
-		tag = ref[idx+1:]
+	if parsed, err = pinDigest(ctx, config, parsed); err != nil {
+		return err
 	}
 
-	// Copy from repository to file store
-	copyOpts := oras.DefaultCopyOptions
-	copyOpts.Concurrency = 1
-
-	_, err = oras.Copy(ctx, repo, tag, fs, tag, copyOpts)
+	for i, candidate := range registryCandidates(config, parsed) {
+		err = orasCopy(ctx, config, provider, candidate, fs, destDir)
+		if err == nil {
+			if i > 0 {
+				log.Printf("Version %s served by mirror %s\n", ref, candidate.Context().RegistryStr())
+			}
+			break
+		}
+		log.Printf("Warning: pulling %s failed: %v\n", candidate.Name(), err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to pull artifact: %w", err)
 	}
@@ -491,7 +557,17 @@ func addLabelsToYAML(yamlData []byte, tag string) ([]byte, error) {
 
 	// Add our labels
 	manifest.Metadata.Labels["managed-by"] = "kyverno-watcher"
-	manifest.Metadata.Labels["policy-version"] = tag
+	manifest.Metadata.Labels["policy-version"] = versionLabelValue(tag)
+
+	// Label values are limited to 63 characters without ':', so keep the
+	// full version (e.g. a sha256 digest) in an annotation when it had to
+	// be shortened
+	if manifest.Metadata.Labels["policy-version"] != tag {
+		if manifest.Metadata.Annotations == nil {
+			manifest.Metadata.Annotations = make(map[string]string)
+		}
+		manifest.Metadata.Annotations["policy-version"] = tag
+	}
 
 	// Marshal back to YAML
 	updatedData, err := yaml.Marshal(&manifest)
@@ -502,52 +578,128 @@ func addLabelsToYAML(yamlData []byte, tag string) ([]byte, error) {
 	return updatedData, nil
 }
 
-func pullOCI(ctx context.Context, imageRef, outputDir string) error {
+// remoteOptions returns the go-containerregistry options for pulls, resolving
+// credentials through the keychain configured by REGISTRY_KEYCHAIN and
+// connecting through the shared transport.
+func remoteOptions(ctx context.Context, config *Config, provider Provider) []remote.Option {
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(keychainFor(ctx, config, provider)),
+		remote.WithTransport(httpTransport(config)),
+	}
+}
+
+// pullOCI pulls imageRef into outputDir. With REGISTRY_MIRRORS set the
+// digest is resolved first and pulled from the registry or the first mirror
+// serving it, so every source delivers identical content.
+func pullOCI(ctx context.Context, config *Config, provider Provider, imageRef, outputDir string) error {
 	// Parse the image reference
-	ref, err := name.ParseReference(imageRef)
+	ref, err := parseReference(config, imageRef)
 	if err != nil {
 		return fmt.Errorf("parsing image reference: %w", err)
 	}
 
-	log.Printf("Pulling files from OCI image: %s\n", ref.Name())
+	if ref, err = pinDigest(ctx, config, ref); err != nil {
+		return err
+	}
+
+	var desc *remote.Descriptor
+	for i, candidate := range registryCandidates(config, ref) {
+		log.Printf("Pulling files from OCI image: %s\n", candidate.Name())
 
-	// Pull the image using default keychain (uses Docker credentials if available)
-	desc, err := remote.Get(ref, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+		desc, err = remote.Get(candidate, remoteOptions(ctx, config, provider)...)
+		if err == nil {
+			if i > 0 {
+				log.Printf("Version %s served by mirror %s\n", imageRef, candidate.Context().RegistryStr())
+			}
+			break
+		}
+		log.Printf("Warning: getting %s failed: %v\n", candidate.Name(), err)
+	}
 	if err != nil {
 		return fmt.Errorf("getting remote image: %w", err)
 	}
 
-	img, err := desc.Image()
-	if err != nil {
+	var img v1.Image
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return fmt.Errorf("converting to image index: %w", err)
+		}
+		if img, err = selectImage(config, idx); err != nil {
+			return err
+		}
+	} else if img, err = desc.Image(); err != nil {
 		return fmt.Errorf("converting to image: %w", err)
 	}
 
+	return extractImage(config, img, outputDir)
+}
+
+// extractImage writes the layers of img into outputDir, streaming each layer
+// to disk within MAX_LAYER_SIZE, MAX_ARTIFACT_SIZE and MAX_FILES. Layers are
+// named after their org.opencontainers.image.title annotation.
+func extractImage(config *Config, img v1.Image, outputDir string) error {
 	// Get image layers
 	layers, err := img.Layers()
 	if err != nil {
 		return fmt.Errorf("getting image layers: %w", err)
 	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("getting image manifest: %w", err)
+	}
+	rawManifest, err := img.RawManifest()
+	if err != nil {
+		return fmt.Errorf("getting image manifest: %w", err)
+	}
+	if err := checkArtifactType(config, rawManifest); err != nil {
+		return err
+	}
 
 	log.Printf("Found %d layers\n", len(layers))
 
 	// Process each layer
-	fileCount := 0
+	x := &layerExtraction{
+		config:    config,
+		outputDir: outputDir,
+		limits:    newPullLimits(config),
+		names:     newLayerNames(),
+	}
 	for i, layer := range layers {
-		if err := processLayer(layer, outputDir, i, &fileCount); err != nil {
+		var title string
+		if i < len(manifest.Layers) {
+			title = manifest.Layers[i].Annotations[ocispec.AnnotationTitle]
+		}
+		if err := processLayer(x, layer, title, i); err != nil {
 			return fmt.Errorf("processing layer %d: %w", i, err)
 		}
 	}
 
-	if fileCount == 0 {
+	if len(layers) > 0 && x.skipped == len(layers) {
+		return errNoAllowedLayers
+	}
+	if x.fileCount == 0 {
 		log.Println("Warning: No files were extracted from the image")
 	} else {
-		log.Printf("Successfully pulled %d file(s)\n", fileCount)
+		log.Printf("Successfully pulled %d file(s)\n", x.fileCount)
 	}
 
 	return nil
 }
 
-func processLayer(layer v1.Layer, outputDir string, layerIndex int, fileCount *int) error {
+// layerExtraction holds the state shared by the layers of one pull.
+type layerExtraction struct {
+	config    *Config
+	outputDir string
+	limits    *pullLimits
+	names     *layerNames
+	fileCount int
+	// skipped counts the layers whose media type is not allowed
+	skipped int
+}
+
+func processLayer(x *layerExtraction, layer v1.Layer, title string, layerIndex int) error {
 	// Get layer media type
 	mediaType, err := layer.MediaType()
 	if err != nil {
@@ -556,6 +708,37 @@ func processLayer(layer v1.Layer, outputDir string, layerIndex int, fileCount *i
 
 	log.Printf("Layer %d media type: %s\n", layerIndex, mediaType)
 
+	if !layerAllowed(x.config, string(mediaType)) {
+		log.Printf("  Layer %d skipped: media type %s is not allowed\n", layerIndex, mediaType)
+		x.skipped++
+		return nil
+	}
+
+	// Reject oversized layers before downloading them
+	size, err := layer.Size()
+	if err != nil {
+		return fmt.Errorf("getting layer size: %w", err)
+	}
+	if err := x.limits.checkLayer(fmt.Sprintf("layer %d", layerIndex), size); err != nil {
+		return err
+	}
+
+	if size == 0 {
+		log.Printf("  Layer %d is empty, skipping\n", layerIndex)
+		return nil
+	}
+
+	// Archives are unpacked into a directory of their own
+	if isArchiveLayer(string(mediaType)) {
+		return processArchiveLayer(x, layer, filepath.Join(x.outputDir, x.names.dir(title, layerIndex)))
+	}
+
+	// Save layer content to file
+	filename := filepath.Join(x.outputDir, x.names.file(title, mediaType, layerIndex))
+	if err := x.limits.addFile(filepath.Base(filename)); err != nil {
+		return err
+	}
+
 	// Get layer content
 	blob, err := layer.Compressed()
 	if err != nil {
@@ -567,35 +750,77 @@ func processLayer(layer v1.Layer, outputDir string, layerIndex int, fileCount *i
 		}
 	}()
 
-	// Read the layer content
-	content, err := io.ReadAll(blob)
+	// Stream the layer content to disk
+	written, err := writeLimitedFile(filename, x.limits.layerReader(fmt.Sprintf("layer %d", layerIndex), blob))
 	if err != nil {
-		return fmt.Errorf("reading layer content: %w", err)
+		return err
 	}
 
-	if len(content) == 0 {
-		log.Printf("  Layer %d is empty, skipping\n", layerIndex)
-		return nil
-	}
+	log.Printf("  Saved to: %s (%d bytes)\n", filepath.Base(filename), written)
+	x.fileCount++
 
-	// Save layer content to file
-	filename := filepath.Join(outputDir, fmt.Sprintf("layer-%d.yaml", layerIndex))
+	return nil
+}
 
-	// If it's a policy layer, try to give it a better name
-	if mediaType == PolicyLayerMediaType {
-		filename = filepath.Join(outputDir, fmt.Sprintf("policy-%d.yaml", layerIndex))
+// processArchiveLayer unpacks a tar or tar+gzip layer into dir, preserving
+// the relative layout of its files for the apply step.
+func processArchiveLayer(x *layerExtraction, layer v1.Layer, dir string) error {
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return fmt.Errorf("getting media type: %w", err)
+	}
+	if err := checkArchiveCompression(string(mediaType)); err != nil {
+		return err
 	}
 
-	if err := os.WriteFile(filename, content, 0644); err != nil {
-		return fmt.Errorf("writing file: %w", err)
+	blob, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("getting compressed layer: %w", err)
 	}
+	defer func() {
+		if cerr := blob.Close(); cerr != nil {
+			log.Printf("Warning: failed to close blob for %s: %v\n", filepath.Base(dir), cerr)
+		}
+	}()
 
-	log.Printf("  Saved to: %s (%d bytes)\n", filepath.Base(filename), len(content))
-	*fileCount++
+	before := x.limits.files
+	if err := extractTar(blob, dir, x.limits); err != nil {
+		return fmt.Errorf("extracting archive: %w", err)
+	}
+	// Read the rest of the blob so its digest is verified
+	if _, err := io.Copy(io.Discard, blob); err != nil {
+		return fmt.Errorf("verifying layer: %w", err)
+	}
+
+	extracted := x.limits.files - before
+	log.Printf("  Extracted %d file(s) to: %s/\n", extracted, filepath.Base(dir))
+	x.fileCount += extracted
 
 	return nil
 }
 
+// writeLimitedFile streams r into path, removing the file again when r
+// fails part way, e.g. because a limit was exceeded.
+func writeLimitedFile(path string, r io.Reader) (int64, error) {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("writing file: %w", err)
+	}
+
+	written, err := io.Copy(out, r)
+	if cerr := out.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("writing file: %w", cerr)
+	}
+	if err != nil {
+		if rerr := os.Remove(path); rerr != nil {
+			log.Printf("Warning: failed to remove %s: %v\n", path, rerr)
+		}
+		return 0, err
+	}
+
+	return written, nil
+}
+
 func applyManifests(config *Config, dir string) error {
 	return applyManifestsFunc(config, dir)
 }
@@ -647,6 +872,29 @@ func findYAMLFiles(dir string) ([]string, error) {
 	return files, err
 }
 
+// maxLabelValueLength is the Kubernetes limit for label values
+const maxLabelValueLength = 63
+
+// versionLabelValue turns a version into a valid Kubernetes label value.
+// Digests such as "sha256:abc..." become "sha256-abc..." truncated to 63
+// characters; other invalid characters are replaced by '_'.
+func versionLabelValue(version string) string {
+	value := []byte(strings.Replace(version, ":", "-", 1))
+	for i, c := range value {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '-' && c != '_' && c != '.' {
+			value[i] = '_'
+		}
+	}
+
+	if len(value) > maxLabelValueLength {
+		value = value[:maxLabelValueLength]
+	}
+
+	// Label values must begin and end with an alphanumeric character
+	return strings.Trim(string(value), "-_.")
+}
+
 func sanitizePath(s string) string {
 	s = strings.ReplaceAll(s, ":", "_")
 	s = strings.ReplaceAll(s, "/", "_")
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -49,6 +51,48 @@ func TestParseImageBase(t *testing.T) {
 			wantPackage: "package",
 			wantErr:     false,
 		},
+		{
+			name:        "registry with port",
+			input:       "registry.local:5000/team/policies",
+			wantOwner:   "team",
+			wantPackage: "policies",
+			wantErr:     false,
+		},
+		{
+			name:        "registry with port and tag",
+			input:       "registry.local:5000/team/nested/policies:v1.0.0",
+			wantOwner:   "team",
+			wantPackage: "nested/policies",
+			wantErr:     false,
+		},
+		{
+			name:        "sha256 digest",
+			input:       "ghcr.io/owner/package@sha256:" + strings.Repeat("ab", 32),
+			wantOwner:   "owner",
+			wantPackage: "package",
+			wantErr:     false,
+		},
+		{
+			name:        "tag and digest",
+			input:       "ghcr.io/owner/package:v1@sha256:" + strings.Repeat("ab", 32),
+			wantOwner:   "owner",
+			wantPackage: "package",
+			wantErr:     false,
+		},
+		{
+			name:        "invalid digest",
+			input:       "ghcr.io/owner/package@sha256:abcd",
+			wantOwner:   "",
+			wantPackage: "",
+			wantErr:     true,
+		},
+		{
+			name:        "implicit Docker Hub registry",
+			input:       "owner/package",
+			wantOwner:   "",
+			wantPackage: "",
+			wantErr:     true,
+		},
 		{
 			name:        "invalid format - no slashes",
 			input:       "invalid",
@@ -143,6 +187,49 @@ func TestSanitizePath(t *testing.T) {
 	}
 }
 
+func TestVersionLabelValue(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("0123456789abcdef", 4)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "semver tag unchanged",
+			input: "v1.2.3",
+			want:  "v1.2.3",
+		},
+		{
+			name:  "digest shortened",
+			input: digest,
+			want:  ("sha256-" + strings.Repeat("0123456789abcdef", 4))[:63],
+		},
+		{
+			name:  "invalid characters replaced",
+			input: "feature/foo+bar",
+			want:  "feature_foo_bar",
+		},
+		{
+			name:  "non-alphanumeric ends trimmed",
+			input: "-rc-",
+			want:  "rc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := versionLabelValue(tt.input)
+			if got != tt.want {
+				t.Errorf("versionLabelValue(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			if len(got) > maxLabelValueLength {
+				t.Errorf("versionLabelValue(%q) length = %d, want <= %d", tt.input, len(got), maxLabelValueLength)
+			}
+		})
+	}
+}
+
 func TestGetEnvOrDefault(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -258,6 +345,9 @@ func TestGetEnvAsIntOrDefault(t *testing.T) {
 }
 
 func TestLoadConfigProvider(t *testing.T) {
+	_, appKeyFile := writeTestGitHubAppKey(t, false)
+	pullSecretFile := writeTestDockerConfig(t, `{"auths":{"registry.example.com":{"username":"robot","password":"secret"}}}`)
+
 	tests := []struct {
 		name         string
 		envVars      map[string]string
@@ -316,6 +406,98 @@ func TestLoadConfigProvider(t *testing.T) {
 			wantErr:      false,
 			wantProvider: "artifactory",
 		},
+		{
+			name: "artifactory provider - invalid discovery",
+			envVars: map[string]string{
+				"PROVIDER":              "artifactory",
+				"ARTIFACTORY_USERNAME":  "user@example.com",
+				"ARTIFACTORY_PASSWORD":  "password123",
+				"ARTIFACTORY_DISCOVERY": "storage",
+				"IMAGE_BASE":            "registry.example.com/repo/image",
+			},
+			wantErr:     true,
+			errContains: "Unsupported ARTIFACTORY_DISCOVERY: storage",
+		},
+		{
+			name: "artifactory provider - pull secret",
+			envVars: map[string]string{
+				"PROVIDER":                  "artifactory",
+				"ARTIFACTORY_DOCKER_CONFIG": pullSecretFile,
+				"IMAGE_BASE":                "registry.example.com/repo/image",
+			},
+			wantErr:      false,
+			wantProvider: "artifactory",
+		},
+		{
+			name: "artifactory provider - missing pull secret",
+			envVars: map[string]string{
+				"PROVIDER":                  "artifactory",
+				"ARTIFACTORY_DOCKER_CONFIG": "/nonexistent/.dockerconfigjson",
+				"IMAGE_BASE":                "registry.example.com/repo/image",
+			},
+			wantErr:     true,
+			errContains: "Invalid ARTIFACTORY_DOCKER_CONFIG",
+		},
+		{
+			name: "oci provider - anonymous",
+			envVars: map[string]string{
+				"PROVIDER":   "oci",
+				"IMAGE_BASE": "registry.example.com/team/policies",
+			},
+			wantErr:      false,
+			wantProvider: "oci",
+		},
+		{
+			name: "oci provider - username without password",
+			envVars: map[string]string{
+				"PROVIDER":          "oci",
+				"IMAGE_BASE":        "registry.example.com/team/policies",
+				"REGISTRY_USERNAME": "robot",
+			},
+			wantErr:     true,
+			errContains: "REGISTRY_USERNAME and REGISTRY_PASSWORD must be set together",
+		},
+		{
+			name: "oci provider - invalid tag order",
+			envVars: map[string]string{
+				"PROVIDER":   "oci",
+				"IMAGE_BASE": "registry.example.com/team/policies",
+				"TAG_ORDER":  "random",
+			},
+			wantErr:     true,
+			errContains: "Unsupported TAG_ORDER: random",
+		},
+		{
+			name: "invalid version constraint",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":       "ghp_test123",
+				"IMAGE_BASE":         "ghcr.io/owner/package",
+				"VERSION_CONSTRAINT": ">=banana",
+			},
+			wantErr:     true,
+			errContains: "Invalid VERSION_CONSTRAINT",
+		},
+		{
+			name: "version constraint with lexical order",
+			envVars: map[string]string{
+				"PROVIDER":           "oci",
+				"IMAGE_BASE":         "registry.example.com/team/policies",
+				"TAG_ORDER":          "lexical",
+				"VERSION_CONSTRAINT": "~1.4",
+			},
+			wantErr:     true,
+			errContains: "VERSION_CONSTRAINT requires TAG_ORDER=semver",
+		},
+		{
+			name: "invalid tag include regex",
+			envVars: map[string]string{
+				"GITHUB_TOKEN":      "ghp_test123",
+				"IMAGE_BASE":        "ghcr.io/owner/package",
+				"TAG_INCLUDE_REGEX": "^v(",
+			},
+			wantErr:     true,
+			errContains: "Invalid TAG_INCLUDE_REGEX",
+		},
 		{
 			name: "invalid provider",
 			envVars: map[string]string{
@@ -335,6 +517,58 @@ func TestLoadConfigProvider(t *testing.T) {
 			wantErr:     true,
 			errContains: "GITHUB_TOKEN environment variable must be set",
 		},
+		{
+			name: "github provider - app authentication",
+			envVars: map[string]string{
+				"GITHUB_APP_ID":               "123",
+				"GITHUB_APP_INSTALLATION_ID":  "42",
+				"GITHUB_APP_PRIVATE_KEY_FILE": appKeyFile,
+				"IMAGE_BASE":                  "ghcr.io/owner/package",
+			},
+			wantErr:      false,
+			wantProvider: "github",
+		},
+		{
+			name: "github provider - app missing installation id",
+			envVars: map[string]string{
+				"GITHUB_APP_ID":               "123",
+				"GITHUB_APP_PRIVATE_KEY_FILE": appKeyFile,
+				"IMAGE_BASE":                  "ghcr.io/owner/package",
+			},
+			wantErr:     true,
+			errContains: "GITHUB_APP_INSTALLATION_ID and GITHUB_APP_PRIVATE_KEY_FILE must be set",
+		},
+		{
+			name: "github provider - app non-numeric installation id",
+			envVars: map[string]string{
+				"GITHUB_APP_ID":               "123",
+				"GITHUB_APP_INSTALLATION_ID":  "abc",
+				"GITHUB_APP_PRIVATE_KEY_FILE": appKeyFile,
+				"IMAGE_BASE":                  "ghcr.io/owner/package",
+			},
+			wantErr:     true,
+			errContains: "Invalid GITHUB_APP_INSTALLATION_ID",
+		},
+		{
+			name: "github provider - app missing key file",
+			envVars: map[string]string{
+				"GITHUB_APP_ID":               "123",
+				"GITHUB_APP_INSTALLATION_ID":  "42",
+				"GITHUB_APP_PRIVATE_KEY_FILE": "/nonexistent/app.pem",
+				"IMAGE_BASE":                  "ghcr.io/owner/package",
+			},
+			wantErr:     true,
+			errContains: "Reading GitHub App private key",
+		},
+		{
+			name: "layout provider - missing path",
+			envVars: map[string]string{
+				"PROVIDER":   "layout",
+				"IMAGE_BASE": "/nonexistent/policies-layout",
+			},
+			wantErr:     true,
+			errContains: "Failed to access OCI layout",
+		},
 		{
 			name: "artifactory provider - missing username",
 			envVars: map[string]string{
@@ -442,10 +676,10 @@ func TestLoadConfigProvider(t *testing.T) {
 			}
 
 			// Verify provider-specific fields are set correctly
-			if config.Provider == "github" && config.GithubToken == "" {
-				t.Error("loadConfig() GithubToken should be set for github provider")
+			if config.Provider == "github" && config.GithubToken == "" && config.GithubAppID == "" {
+				t.Error("loadConfig() GithubToken or GithubAppID should be set for github provider")
 			}
-			if config.Provider == "artifactory" {
+			if config.Provider == "artifactory" && config.ArtifactoryDockerConfig == "" {
 				if config.Username == "" {
 					t.Error("loadConfig() Username should be set for artifactory provider")
 				}
@@ -466,11 +700,11 @@ func TestWatchLoopProviderBehavior(t *testing.T) {
 		errContains string
 	}{
 		{
-			name:        "artifactory - image base without tag",
+			name:        "artifactory - invalid image base",
 			provider:    "artifactory",
-			imageBase:   "registry.example.com/repo/image",
+			imageBase:   "registry.example.com/Repo/Image",
 			wantErr:     true,
-			errContains: "IMAGE_BASE for artifactory must include a tag",
+			errContains: "parsing IMAGE_BASE",
 		},
 		{
 			name:      "artifactory - image base with tag",
@@ -488,7 +722,7 @@ func TestWatchLoopProviderBehavior(t *testing.T) {
 			// Mock pullImageToDir to avoid creating /tmp/image-* directories
 			originalPullImageToDirFunc := pullImageToDirFunc
 			pullImageToDirCalled := false
-			pullImageToDirFunc = func(config *Config, tag, destDir string) error {
+			pullImageToDirFunc = func(ctx context.Context, config *Config, tag, destDir string) error {
 				pullImageToDirCalled = true
 				// Create files in test temp dir instead of /tmp
 				testDestDir := testTempDir + "/image-" + sanitizePath(tag)
@@ -506,6 +740,15 @@ func TestWatchLoopProviderBehavior(t *testing.T) {
 				pullImageToDirFunc = originalPullImageToDirFunc
 			}()
 
+			// Mock digest resolution to avoid contacting the registry
+			originalResolveDigestFunc := resolveDigestFunc
+			resolveDigestFunc = func(ctx context.Context, config *Config, imageRef string) (string, bool, error) {
+				return "sha256:0000000000000000000000000000000000000000000000000000000000000000", false, nil
+			}
+			defer func() {
+				resolveDigestFunc = originalResolveDigestFunc
+			}()
+
 			// Mock kubectl apply to avoid actual execution
 			originalApplyManifestsFunc := applyManifestsFunc
 			applyManifestsCalled := false
@@ -524,7 +767,7 @@ func TestWatchLoopProviderBehavior(t *testing.T) {
 			}
 			config.LastFile = config.StateDir + "/last_seen"
 
-			err := watchLoop(config)
+			err := watchLoop(context.Background(), config)
 
 			if tt.wantErr {
 				if err == nil {
@@ -554,6 +797,73 @@ func TestWatchLoopProviderBehavior(t *testing.T) {
 	}
 }
 
+func TestWatchLoopDetectsDigestChange(t *testing.T) {
+	repo := newTestRegistry(t) + "/team/policies"
+	pushPolicyImage(t, repo+":v1.0.0", newPolicyImage(t, testPolicyYAML))
+
+	var pulls []string
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(ctx context.Context, config *Config, tag, destDir string) error {
+		pulls = append(pulls, tag)
+		return nil
+	}
+	defer func() {
+		pullImageToDirFunc = originalPullImageToDirFunc
+	}()
+
+	originalApplyManifestsFunc := applyManifestsFunc
+	applyManifestsFunc = func(config *Config, dir string) error {
+		return nil
+	}
+	defer func() {
+		applyManifestsFunc = originalApplyManifestsFunc
+	}()
+
+	stateDir := t.TempDir()
+	config := &Config{
+		Provider:  "oci",
+		ImageBase: repo,
+		TagOrder:  TagOrderSemver,
+		StateDir:  stateDir,
+		LastFile:  stateDir + "/last_seen",
+	}
+
+	// First poll applies, second poll sees no change
+	for i := 0; i < 2; i++ {
+		if err := watchLoop(context.Background(), config); err != nil {
+			t.Fatalf("watchLoop() error = %v", err)
+		}
+	}
+	if len(pulls) != 1 {
+		t.Fatalf("pulls after unchanged polls = %v, want exactly one", pulls)
+	}
+
+	first, err := readState(config.LastFile)
+	if err != nil {
+		t.Fatalf("readState() error = %v", err)
+	}
+	if first.Tag != "v1.0.0" || !strings.HasPrefix(first.Digest, "sha256:") {
+		t.Fatalf("state after first apply = %+v, want tag v1.0.0 with digest", first)
+	}
+
+	// Re-push the same tag with different content
+	pushPolicyImage(t, repo+":v1.0.0", newPolicyImage(t, testPolicyYAML+"    # changed\n"))
+	if err := watchLoop(context.Background(), config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if len(pulls) != 2 {
+		t.Fatalf("pulls after re-push = %v, want a second pull", pulls)
+	}
+
+	second, err := readState(config.LastFile)
+	if err != nil {
+		t.Fatalf("readState() error = %v", err)
+	}
+	if second.Tag != "v1.0.0" || second.Digest == first.Digest {
+		t.Errorf("state after re-push = %+v, want new digest for v1.0.0 (was %s)", second, first.Digest)
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
 		(len(s) > 0 && len(substr) > 0 && containsHelper(s, substr)))
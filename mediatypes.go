@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+)
+
+// defaultLayerMediaTypes are extracted when ALLOWED_LAYER_MEDIA_TYPES is
+// not set: the Kyverno policy layer, plain YAML and tar bundles.
+var defaultLayerMediaTypes = []string{
+	PolicyLayerMediaType,
+	"application/yaml",
+	"application/x-yaml",
+	"text/yaml",
+	"text/x-yaml",
+	"application/vnd.oci.image.layer.v1.tar",
+	"application/vnd.oci.image.layer.v1.tar+gzip",
+	"application/vnd.docker.image.rootfs.diff.tar.gzip",
+}
+
+// errNoAllowedLayers aborts a version whose layers were all skipped, so it
+// is not recorded as applied.
+var errNoAllowedLayers = errors.New("no layer has a media type allowed by ALLOWED_LAYER_MEDIA_TYPES")
+
+// loadMediaTypeConfig reads ALLOWED_LAYER_MEDIA_TYPES, the layers that are
+// extracted, and ALLOWED_ARTIFACT_TYPES, the artifact types (or config media
+// types) that are accepted at all. Entries ending in * match by prefix.
+func loadMediaTypeConfig(config *Config) error {
+	config.LayerMediaTypes = splitList(getEnvFunc("ALLOWED_LAYER_MEDIA_TYPES"))
+	config.ArtifactTypes = splitList(getEnvFunc("ALLOWED_ARTIFACT_TYPES"))
+
+	for _, mediaType := range slices.Concat(config.LayerMediaTypes, config.ArtifactTypes) {
+		if !strings.Contains(mediaType, "/") {
+			return fmt.Errorf("invalid media type %s in ALLOWED_LAYER_MEDIA_TYPES or ALLOWED_ARTIFACT_TYPES (must be type/subtype)", mediaType)
+		}
+	}
+	if len(config.LayerMediaTypes) > 0 {
+		log.Printf("Extracting layers of media type: %s\n", strings.Join(config.LayerMediaTypes, ", "))
+	}
+	if len(config.ArtifactTypes) > 0 {
+		log.Printf("Accepting artifacts of type: %s\n", strings.Join(config.ArtifactTypes, ", "))
+	}
+
+	return nil
+}
+
+// matchMediaType reports whether mediaType is listed in patterns.
+func matchMediaType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(mediaType, prefix) {
+				return true
+			}
+		} else if pattern == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// layerAllowed reports whether layers of mediaType are extracted.
+func layerAllowed(config *Config, mediaType string) bool {
+	if len(config.LayerMediaTypes) == 0 {
+		return matchMediaType(defaultLayerMediaTypes, mediaType)
+	}
+	return matchMediaType(config.LayerMediaTypes, mediaType)
+}
+
+// checkArtifactType rejects a manifest whose artifactType, or config media
+// type when it has none, is not listed in ALLOWED_ARTIFACT_TYPES.
+func checkArtifactType(config *Config, rawManifest []byte) error {
+	if len(config.ArtifactTypes) == 0 {
+		return nil
+	}
+
+	var manifest struct {
+		ArtifactType string `json:"artifactType"`
+		Config       struct {
+			MediaType string `json:"mediaType"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		return fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	artifactType := manifest.ArtifactType
+	if artifactType == "" {
+		artifactType = manifest.Config.MediaType
+	}
+	if !matchMediaType(config.ArtifactTypes, artifactType) {
+		return fmt.Errorf("artifact type %q is not allowed by ALLOWED_ARTIFACT_TYPES", artifactType)
+	}
+	return nil
+}
+
+// orasFindSuccessors checks the artifact type of every manifest oras.Copy
+// visits and drops the layers whose media type is not allowed, so the file
+// store never writes them.
+func orasFindSuccessors(config *Config) func(ctx context.Context, fetcher content.Fetcher, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	return func(ctx context.Context, fetcher content.Fetcher, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		if desc.MediaType == ocispec.MediaTypeImageManifest || desc.MediaType == string(types.DockerManifestSchema2) {
+			raw, err := content.FetchAll(ctx, fetcher, desc)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkArtifactType(config, raw); err != nil {
+				return nil, err
+			}
+		}
+
+		successors, err := content.Successors(ctx, fetcher, desc)
+		if err != nil {
+			return nil, err
+		}
+
+		allowed := successors[:0]
+		var titled, skipped int
+		for _, s := range successors {
+			title := s.Annotations[ocispec.AnnotationTitle]
+			if title == "" {
+				allowed = append(allowed, s)
+				continue
+			}
+			titled++
+			if !layerAllowed(config, s.MediaType) {
+				log.Printf("  %s skipped: media type %s is not allowed\n", title, s.MediaType)
+				skipped++
+				continue
+			}
+			allowed = append(allowed, s)
+		}
+		// Nothing would reach the cluster, so the version must not be recorded
+		if titled > 0 && skipped == titled {
+			return nil, errNoAllowedLayers
+		}
+		return allowed, nil
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestLoadMediaTypeConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantLayers  []string
+		errContains string
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{},
+		},
+		{
+			name:       "custom list",
+			env:        map[string]string{"ALLOWED_LAYER_MEDIA_TYPES": "application/yaml, application/vnd.oci.image.layer.v1.tar*"},
+			wantLayers: []string{"application/yaml", "application/vnd.oci.image.layer.v1.tar*"},
+		},
+		{
+			name:        "invalid layer media type",
+			env:         map[string]string{"ALLOWED_LAYER_MEDIA_TYPES": "yaml"},
+			errContains: "invalid media type yaml",
+		},
+		{
+			name:        "invalid artifact type",
+			env:         map[string]string{"ALLOWED_ARTIFACT_TYPES": "kyverno"},
+			errContains: "invalid media type kyverno",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalGetEnvFunc := getEnvFunc
+			getEnvFunc = func(key string) string {
+				return tt.env[key]
+			}
+			defer func() {
+				getEnvFunc = originalGetEnvFunc
+			}()
+
+			config := &Config{}
+			err := loadMediaTypeConfig(config)
+			if tt.errContains != "" {
+				if err == nil || !contains(err.Error(), tt.errContains) {
+					t.Errorf("loadMediaTypeConfig() error = %v, want to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadMediaTypeConfig() error = %v", err)
+			}
+			if strings.Join(config.LayerMediaTypes, ",") != strings.Join(tt.wantLayers, ",") {
+				t.Errorf("LayerMediaTypes = %v, want %v", config.LayerMediaTypes, tt.wantLayers)
+			}
+		})
+	}
+}
+
+func TestLayerAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowed   []string
+		mediaType string
+		want      bool
+	}{
+		{name: "default policy layer", mediaType: PolicyLayerMediaType, want: true},
+		{name: "default yaml", mediaType: "application/yaml", want: true},
+		{name: "default readme", mediaType: "text/markdown", want: false},
+		{name: "default sbom", mediaType: "application/spdx+json", want: false},
+		{name: "default tar+gzip", mediaType: "application/vnd.oci.image.layer.v1.tar+gzip", want: true},
+		{name: "default docker tar+gzip", mediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", want: true},
+		{name: "default zstd", mediaType: "application/vnd.oci.image.layer.v1.tar+zstd", want: false},
+		{name: "prefix", allowed: []string{"application/vnd.oci.image.layer.v1.tar*"}, mediaType: "application/vnd.oci.image.layer.v1.tar+gzip", want: true},
+		{name: "custom list replaces defaults", allowed: []string{"application/yaml"}, mediaType: PolicyLayerMediaType, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{LayerMediaTypes: tt.allowed}
+			if got := layerAllowed(config, tt.mediaType); got != tt.want {
+				t.Errorf("layerAllowed(%q) = %v, want %v", tt.mediaType, got, tt.want)
+			}
+		})
+	}
+}
+
+// newMixedArtifact builds an artifact carrying a policy next to a README and
+// an SBOM, each titled like `oras push` does.
+func newMixedArtifact(t *testing.T, configMediaType types.MediaType) v1.Image {
+	t.Helper()
+	img := mutate.ConfigMediaType(empty.Image, configMediaType)
+	for _, layer := range []struct {
+		title     string
+		content   string
+		mediaType types.MediaType
+	}{
+		{title: "require-labels.yaml", content: testPolicyYAML, mediaType: PolicyLayerMediaType},
+		{title: "README.md", content: "# Policies\n", mediaType: "text/markdown"},
+		{title: "sbom.spdx.json", content: "{}", mediaType: "application/spdx+json"},
+	} {
+		var err error
+		img, err = mutate.Append(img, mutate.Addendum{
+			Layer:       static.NewLayer([]byte(layer.content), layer.mediaType),
+			Annotations: map[string]string{ocispec.AnnotationTitle: layer.title},
+		})
+		if err != nil {
+			t.Fatalf("building image: %v", err)
+		}
+	}
+	return img
+}
+
+// listFiles returns the names of the files in dir.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestExtractImageMediaTypeAllowlist(t *testing.T) {
+	img := newMixedArtifact(t, "application/vnd.cncf.kyverno.config.v1+json")
+
+	dir := t.TempDir()
+	if err := extractImage(&Config{}, img, dir); err != nil {
+		t.Fatalf("extractImage() error = %v", err)
+	}
+	if got := listFiles(t, dir); len(got) != 1 || got[0] != "require-labels.yaml" {
+		t.Errorf("extracted files = %v, want only require-labels.yaml", got)
+	}
+
+	// Non-policy artifacts are rejected outright
+	config := &Config{ArtifactTypes: []string{"application/vnd.cncf.kyverno.*"}}
+	if err := extractImage(config, img, t.TempDir()); err != nil {
+		t.Errorf("extractImage() error = %v for an allowed artifact type", err)
+	}
+	err := extractImage(config, newMixedArtifact(t, types.OCIConfigJSON), t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "is not allowed by ALLOWED_ARTIFACT_TYPES") {
+		t.Errorf("extractImage() error = %v, want artifact type rejection", err)
+	}
+
+	// A version without any allowed layer is not applied
+	config = &Config{LayerMediaTypes: []string{"application/x-policy"}}
+	if err := extractImage(config, img, t.TempDir()); !errors.Is(err, errNoAllowedLayers) {
+		t.Errorf("extractImage() error = %v, want %v", err, errNoAllowedLayers)
+	}
+}
+
+func TestOrasPullMediaTypeAllowlist(t *testing.T) {
+	host := newTestRegistry(t)
+	pushPolicyImage(t, host+"/team/policies:v1", newMixedArtifact(t, "application/vnd.cncf.kyverno.config.v1+json"))
+	pushPolicyImage(t, host+"/team/image:v1", newMixedArtifact(t, types.OCIConfigJSON))
+
+	config := &Config{Provider: "oci", ImageBase: host + "/team/policies", InsecureRegistries: []string{host}}
+	destDir := filepath.Join(t.TempDir(), "policies")
+	if err := orasPull(context.Background(), config, host+"/team/policies:v1", destDir); err != nil {
+		t.Fatalf("orasPull() error = %v", err)
+	}
+	if got := listFiles(t, destDir); len(got) != 1 || got[0] != "require-labels.yaml" {
+		t.Errorf("pulled files = %v, want only require-labels.yaml", got)
+	}
+
+	config.LayerMediaTypes = []string{"application/x-policy"}
+	err := orasPull(context.Background(), config, host+"/team/policies:v1", filepath.Join(t.TempDir(), "none"))
+	if !errors.Is(err, errNoAllowedLayers) {
+		t.Errorf("orasPull() error = %v, want %v", err, errNoAllowedLayers)
+	}
+
+	config.LayerMediaTypes = nil
+	config.ArtifactTypes = []string{"application/vnd.cncf.kyverno.config.v1+json"}
+	err = orasPull(context.Background(), config, host+"/team/image:v1", filepath.Join(t.TempDir(), "image"))
+	if err == nil || !strings.Contains(err.Error(), "is not allowed by ALLOWED_ARTIFACT_TYPES") {
+		t.Errorf("orasPull() error = %v, want artifact type rejection", err)
+	}
+}
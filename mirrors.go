@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// loadMirrorConfig reads REGISTRY_MIRRORS, the ordered list of registries
+// tried when the registry of IMAGE_BASE is unavailable. Entries are a
+// registry host optionally followed by a path prefix the repository is
+// mirrored under, e.g. "mirror.example.com/ghcr".
+func loadMirrorConfig(config *Config) error {
+	mirrors := splitList(getEnvFunc("REGISTRY_MIRRORS"))
+	for _, mirror := range mirrors {
+		if _, err := name.NewRepository(strings.TrimSuffix(mirror, "/") + "/probe"); err != nil {
+			return fmt.Errorf("invalid REGISTRY_MIRRORS entry %s: %v", mirror, err)
+		}
+	}
+	if len(mirrors) > 0 {
+		log.Printf("Using registry mirrors: %s\n", strings.Join(mirrors, ", "))
+	}
+
+	config.Mirrors = mirrors
+	return nil
+}
+
+// mirrorRepositories returns repo followed by the same repository on every
+// mirror, in the order they are tried.
+func mirrorRepositories(config *Config, repo name.Repository) []name.Repository {
+	repos := []name.Repository{repo}
+	for _, mirror := range config.Mirrors {
+		s := strings.TrimSuffix(mirror, "/") + "/" + repo.RepositoryStr()
+		mirrored, err := name.NewRepository(s)
+		if err == nil && isInsecureRegistry(config, mirrored.RegistryStr()) {
+			mirrored, err = name.NewRepository(s, name.Insecure)
+		}
+		if err != nil {
+			log.Printf("Warning: skipping mirror %s for %s: %v\n", mirror, repo.Name(), err)
+			continue
+		}
+		repos = append(repos, mirrored)
+	}
+	return repos
+}
+
+// registryCandidates returns ref followed by the same tag or digest on every
+// mirror, in the order they are tried.
+func registryCandidates(config *Config, ref name.Reference) []name.Reference {
+	var candidates []name.Reference
+	for _, repo := range mirrorRepositories(config, ref.Context()) {
+		if digest, ok := ref.(name.Digest); ok {
+			candidates = append(candidates, repo.Digest(digest.DigestStr()))
+		} else {
+			candidates = append(candidates, repo.Tag(ref.Identifier()))
+		}
+	}
+	return candidates
+}
+
+// mirrorDigest resolves the digest of ref from the mirrors after the
+// registry itself failed. Every reachable mirror has to report the same
+// digest, so a single stale mirror cannot change the applied content.
+func mirrorDigest(ctx context.Context, config *Config, provider Provider, ref name.Reference) (string, error) {
+	var digest, servedBy string
+	for _, mirror := range registryCandidates(config, ref)[1:] {
+		desc, err := remote.Head(mirror, remoteOptions(ctx, config, provider)...)
+		if err != nil {
+			log.Printf("Warning: mirror %s unavailable: %v\n", mirror.Context().RegistryStr(), err)
+			continue
+		}
+		if digest != "" && desc.Digest.String() != digest {
+			return "", fmt.Errorf("mirrors disagree on the digest of %s: %s has %s, %s has %s",
+				ref.Name(), servedBy, digest, mirror.Context().RegistryStr(), desc.Digest)
+		}
+		digest, servedBy = desc.Digest.String(), mirror.Context().RegistryStr()
+	}
+	if digest == "" {
+		return "", fmt.Errorf("no mirror of %s is available", ref.Context().RegistryStr())
+	}
+
+	log.Printf("Resolved %s to %s from mirror %s\n", ref.Name(), digest, servedBy)
+	return digest, nil
+}
+
+// pinDigest returns ref by digest when mirrors are configured, so that
+// whichever registry serves the pull delivers the content the registry (or
+// all available mirrors) agree on.
+func pinDigest(ctx context.Context, config *Config, ref name.Reference) (name.Reference, error) {
+	if len(config.Mirrors) == 0 {
+		return ref, nil
+	}
+	if _, ok := ref.(name.Digest); ok {
+		return ref, nil
+	}
+
+	digest, _, err := resolveDigest(ctx, config, ref.Name())
+	if err != nil {
+		return nil, err
+	}
+	return ref.Context().Digest(digest), nil
+}
+
+// olderThanApplied reports whether tag sorts before the version last applied
+// by the watcher, which a lagging mirror must not roll back to.
+func olderThanApplied(config *Config, tag, order string) bool {
+	prev, err := readState(config.LastFile)
+	if err != nil || prev.Tag == "" || prev.Tag == tag {
+		return false
+	}
+	newest, err := newestTag([]string{tag, prev.Tag}, order)
+	return err == nil && newest == prev.Tag
+}
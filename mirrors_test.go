@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// unavailableRegistry returns the host of a registry that refuses connections.
+func unavailableRegistry(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestMirrorRepositories(t *testing.T) {
+	config := &Config{Mirrors: []string{"mirror.example.com", "cache.example.com/ghcr/", "lab.example.com:5000"}, InsecureRegistries: []string{"lab.example.com:5000"}}
+	repo, err := name.NewRepository("ghcr.io/owner/policies")
+	if err != nil {
+		t.Fatalf("NewRepository() error = %v", err)
+	}
+
+	repos := mirrorRepositories(config, repo)
+	want := []string{"ghcr.io/owner/policies", "mirror.example.com/owner/policies", "cache.example.com/ghcr/owner/policies", "lab.example.com:5000/owner/policies"}
+	if len(repos) != len(want) {
+		t.Fatalf("mirrorRepositories() = %v, want %v", repos, want)
+	}
+	for i := range want {
+		if repos[i].Name() != want[i] {
+			t.Errorf("mirrorRepositories()[%d] = %s, want %s", i, repos[i].Name(), want[i])
+		}
+	}
+	if repos[3].Scheme() != "http" {
+		t.Errorf("insecure mirror scheme = %s, want http", repos[3].Scheme())
+	}
+
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	candidates := registryCandidates(config, repo.Digest(digest))
+	if got := candidates[1].Name(); got != "mirror.example.com/owner/policies@"+digest {
+		t.Errorf("registryCandidates() mirror = %s, want the digest on the mirror", got)
+	}
+}
+
+func TestMirrorDiscoveryAndPull(t *testing.T) {
+	primary := unavailableRegistry(t)
+	stale := newTestRegistry(t)
+	current := newTestRegistry(t)
+
+	pushPolicyImage(t, stale+"/team/policies:v1.0.0", newPolicyImage(t, testPolicyYAML))
+	for _, tag := range []string{"v1.0.0", "v1.1.0"} {
+		pushPolicyImage(t, current+"/team/policies:"+tag, newPolicyImage(t, strings.Replace(testPolicyYAML, "name: check", "name: check-"+tag, 1)))
+	}
+
+	stateDir := t.TempDir()
+	config := &Config{
+		Provider:  "oci",
+		ImageBase: primary + "/team/policies",
+		TagOrder:  TagOrderSemver,
+		Mirrors:   []string{current},
+		StateDir:  stateDir,
+		LastFile:  filepath.Join(stateDir, "last_seen"),
+	}
+	p, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+	ctx := context.Background()
+
+	latest, err := p.LatestVersion(ctx)
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "v1.1.0" {
+		t.Fatalf("LatestVersion() = %q, want v1.1.0 from the mirror", latest)
+	}
+
+	destDir := filepath.Join(t.TempDir(), "image")
+	if err := pullImageToDirReal(context.Background(), config, latest, destDir); err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(destDir, "policy-0.yaml"))
+	if err != nil {
+		t.Fatalf("reading pulled policy: %v", err)
+	}
+	if !strings.Contains(string(data), "name: check-v1.1.0") {
+		t.Errorf("pulled policy = %q, want the v1.1.0 content", data)
+	}
+
+	// A lagging mirror must not roll back the applied version
+	if err := writeState(config.LastFile, State{Tag: "v1.1.0"}); err != nil {
+		t.Fatalf("writeState() error = %v", err)
+	}
+	config.Mirrors = []string{stale}
+	latest, err = p.LatestVersion(ctx)
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "" {
+		t.Errorf("LatestVersion() = %q from a stale mirror, want no version older than v1.1.0", latest)
+	}
+
+	// Mirrors disagreeing on the digest of a tag are not trusted
+	config.Mirrors = []string{stale, current}
+	ref, err := p.Reference("v1.0.0")
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if _, _, err := resolveDigest(ctx, config, ref); err == nil || !strings.Contains(err.Error(), "mirrors disagree") {
+		t.Errorf("resolveDigest() error = %v, want mirrors disagree", err)
+	}
+}
+
+func TestMirrorPullEnforcesDigest(t *testing.T) {
+	// The registry answers digest lookups but fails to serve manifests
+	primary := newTestRegistry(t, func(upstream http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			upstream.ServeHTTP(w, r)
+		})
+	})
+	stale := newTestRegistry(t)
+	current := newTestRegistry(t)
+
+	img := newPolicyImage(t, strings.Replace(testPolicyYAML, "name: check", "name: check-v1", 1))
+	pushPolicyImage(t, primary+"/team/policies:v1", img)
+	pushPolicyImage(t, stale+"/team/policies:v1", newPolicyImage(t, strings.Replace(testPolicyYAML, "name: check", "name: check-stale", 1)))
+	pushPolicyImage(t, current+"/team/policies:v1", img)
+
+	config := &Config{Provider: "oci", ImageBase: primary + "/team/policies", Mirrors: []string{stale, current}}
+	destDir := filepath.Join(t.TempDir(), "image")
+	if err := pullImageToDirReal(context.Background(), config, "v1", destDir); err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(destDir, "policy-0.yaml"))
+	if err != nil {
+		t.Fatalf("reading pulled policy: %v", err)
+	}
+	if !strings.Contains(string(data), "name: check-v1") {
+		t.Errorf("pulled policy = %q, want the registry's content rather than the stale mirror's", data)
+	}
+}
+
+func TestMirrorDigestDoesNotMoveAppliedTag(t *testing.T) {
+	primary := unavailableRegistry(t)
+	stale := newTestRegistry(t)
+	pushPolicyImage(t, stale+"/team/policies:v1", newPolicyImage(t, testPolicyYAML))
+
+	originalPullImageToDirFunc := pullImageToDirFunc
+	originalApplyManifestsFunc := applyManifestsFunc
+	pulled := false
+	pullImageToDirFunc = func(ctx context.Context, config *Config, tag, destDir string) error {
+		pulled = true
+		return nil
+	}
+	applyManifestsFunc = func(config *Config, dir string) error {
+		return nil
+	}
+	defer func() {
+		pullImageToDirFunc = originalPullImageToDirFunc
+		applyManifestsFunc = originalApplyManifestsFunc
+	}()
+
+	stateDir := t.TempDir()
+	config := &Config{
+		Provider:  "oci",
+		ImageBase: primary + "/team/policies",
+		Mirrors:   []string{stale},
+		StateDir:  stateDir,
+		LastFile:  filepath.Join(stateDir, "last_seen"),
+	}
+	applied := State{Tag: "v1", Digest: "sha256:" + strings.Repeat("ab", 32)}
+	if err := writeState(config.LastFile, applied); err != nil {
+		t.Fatalf("writeState() error = %v", err)
+	}
+
+	if err := watchLoop(context.Background(), config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	if pulled {
+		t.Error("the stale mirror's content of v1 was pulled")
+	}
+	state, err := readState(config.LastFile)
+	if err != nil {
+		t.Fatalf("readState() error = %v", err)
+	}
+	if state != applied {
+		t.Errorf("state = %s, want %s kept while only the mirror answers", state, applied)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provider abstracts a registry that publishes policy artifacts. Each
+// implementation knows how to discover the newest version of the configured
+// artifact, how to turn that version into a pullable reference and which
+// credentials to present when pulling it.
+type Provider interface {
+	// Name returns the PROVIDER value the provider is registered under.
+	Name() string
+	// LatestVersion returns the newest available version of the artifact.
+	// An empty version with a nil error means no versions were found.
+	LatestVersion(ctx context.Context) (string, error)
+	// Reference resolves a version returned by LatestVersion to a full
+	// image reference that can be pulled.
+	Reference(version string) (string, error)
+	// Credentials returns the credentials used when pulling from registry.
+	// An empty Credential defers to the next source of REGISTRY_KEYCHAIN.
+	Credentials(ctx context.Context, registry string) (Credential, error)
+}
+
+// Puller is implemented by providers that need their own pull mechanism
+// instead of the default go-containerregistry based pullOCI.
+type Puller interface {
+	Pull(ctx context.Context, ref, destDir string) error
+}
+
+// DigestResolver is implemented by providers whose artifacts are not served
+// by a registry, so their manifest digests cannot be resolved with a HEAD
+// request.
+type DigestResolver interface {
+	Digest(ctx context.Context, ref string) (string, error)
+}
+
+// Credential holds registry credentials for a pull.
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Empty reports whether no credentials are set.
+func (c Credential) Empty() bool {
+	return c.Username == "" && c.Password == ""
+}
+
+// providerRegistration describes how a provider is configured and built.
+type providerRegistration struct {
+	// configure reads provider-specific settings from the environment into
+	// config. It is called by loadConfig and errors are fatal.
+	configure func(config *Config) error
+	// build creates the provider for an already loaded config.
+	build func(config *Config) (Provider, error)
+}
+
+var providerRegistry = map[string]providerRegistration{}
+
+// registerProvider makes a provider selectable via PROVIDER=name.
+func registerProvider(name string, reg providerRegistration) {
+	if _, exists := providerRegistry[name]; exists {
+		panic(fmt.Sprintf("provider %q registered twice", name))
+	}
+	providerRegistry[name] = reg
+}
+
+// lookupProvider returns the registration for name or an error listing the
+// supported providers.
+func lookupProvider(name string) (providerRegistration, error) {
+	reg, ok := providerRegistry[name]
+	if !ok {
+		return providerRegistration{}, fmt.Errorf("unsupported PROVIDER: %s (must be one of: %s)",
+			name, strings.Join(providerNames(), ", "))
+	}
+	return reg, nil
+}
+
+// providerNames returns the registered provider names in sorted order.
+func providerNames() []string {
+	names := make([]string, 0, len(providerRegistry))
+	for name := range providerRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providerFor returns the provider for config, building it on first use so
+// that state kept by the provider survives across polls.
+func providerFor(config *Config) (Provider, error) {
+	if config.provider != nil {
+		return config.provider, nil
+	}
+
+	reg, err := lookupProvider(config.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := reg.build(config)
+	if err != nil {
+		return nil, fmt.Errorf("building %s provider: %w", config.Provider, err)
+	}
+	config.provider = p
+
+	return p, nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Artifactory tag discovery methods selectable via ARTIFACTORY_DISCOVERY.
+const (
+	// ArtifactoryDiscoveryTags lists tags through the Docker/OCI
+	// /v2/<name>/tags/list API and orders them by TAG_ORDER.
+	ArtifactoryDiscoveryTags = "tags"
+	// ArtifactoryDiscoveryAQL queries Artifactory's AQL search API and picks
+	// the most recently modified tag.
+	ArtifactoryDiscoveryAQL = "aql"
+)
+
+func init() {
+	registerProvider("artifactory", providerRegistration{
+		configure: configureArtifactory,
+		build: func(config *Config) (Provider, error) {
+			return newArtifactoryProvider(config)
+		},
+	})
+}
+
+// artifactoryProvider discovers tags of an Artifactory Docker/OCI repository
+// and pulls them using ORAS. When IMAGE_BASE carries a tag, that tag is
+// pinned and no discovery happens.
+type artifactoryProvider struct {
+	config    *Config
+	repo      name.Repository
+	pinnedTag string
+	client    *http.Client
+	// dockerConfig is set when ARTIFACTORY_DOCKER_CONFIG names a file
+	dockerConfig *dockerConfigFile
+}
+
+func newArtifactoryProvider(config *Config) (*artifactoryProvider, error) {
+	repo, err := imageRepository(config)
+	if err != nil {
+		return nil, fmt.Errorf("parsing IMAGE_BASE: %w", err)
+	}
+
+	p := &artifactoryProvider{
+		config: config,
+		repo:   repo,
+		client: &http.Client{Transport: httpTransport(config)},
+	}
+	if config.ArtifactoryDockerConfig != "" {
+		p.dockerConfig = newDockerConfigFile(config.ArtifactoryDockerConfig)
+	}
+	// A digest in IMAGE_BASE pins more precisely than a tag next to it
+	p.pinnedTag = config.ImageTag
+	if config.ImageDigest != "" {
+		p.pinnedTag = config.ImageDigest
+	}
+
+	return p, nil
+}
+
+// configureArtifactory reads the Artifactory credentials and the tag
+// discovery settings. Credentials are a static username and password, a
+// Docker config file such as a mounted pull secret, a credential helper or
+// a combination of them.
+func configureArtifactory(config *Config) error {
+	if err := loadImageReference(config); err != nil {
+		return err
+	}
+
+	username := strings.TrimSpace(getEnvFunc("ARTIFACTORY_USERNAME"))
+	password := strings.TrimSpace(getEnvFunc("ARTIFACTORY_PASSWORD"))
+	dockerConfig := strings.TrimSpace(getEnvFunc("ARTIFACTORY_DOCKER_CONFIG"))
+	helper := strings.TrimSpace(getEnvFunc("ARTIFACTORY_CREDENTIAL_HELPER"))
+	if (username == "") != (password == "") || (username == "" && dockerConfig == "" && helper == "") {
+		return errors.New("ARTIFACTORY_USERNAME and ARTIFACTORY_PASSWORD environment variables must be set for artifactory provider (or ARTIFACTORY_DOCKER_CONFIG / ARTIFACTORY_CREDENTIAL_HELPER)")
+	}
+	if username != "" {
+		log.Printf("Using Artifactory with username: %s\n", username)
+	}
+	if dockerConfig != "" {
+		if err := newDockerConfigFile(dockerConfig).load(); err != nil {
+			return fmt.Errorf("invalid ARTIFACTORY_DOCKER_CONFIG: %v", err)
+		}
+		log.Printf("Using Artifactory credentials from %s\n", dockerConfig)
+	}
+	if helper != "" {
+		if !credentialHelperName.MatchString(helper) {
+			return fmt.Errorf("invalid ARTIFACTORY_CREDENTIAL_HELPER: %s", helper)
+		}
+		if _, err := exec.LookPath("docker-credential-" + helper); err != nil {
+			return fmt.Errorf("credential helper docker-credential-%s not found in PATH", helper)
+		}
+		log.Printf("Using Artifactory credentials from docker-credential-%s\n", helper)
+	}
+
+	tagOrder, err := loadTagOrder()
+	if err != nil {
+		return err
+	}
+
+	discovery := strings.ToLower(getEnvOrDefault("ARTIFACTORY_DISCOVERY", ArtifactoryDiscoveryTags))
+	switch discovery {
+	case ArtifactoryDiscoveryTags, ArtifactoryDiscoveryAQL:
+	default:
+		return fmt.Errorf("unsupported ARTIFACTORY_DISCOVERY: %s (must be '%s' or '%s')",
+			discovery, ArtifactoryDiscoveryTags, ArtifactoryDiscoveryAQL)
+	}
+
+	config.Username = username
+	config.Password = password
+	config.ArtifactoryDockerConfig = dockerConfig
+	config.ArtifactoryCredentialHelper = helper
+	config.TagOrder = tagOrder
+	config.ArtifactoryDiscovery = discovery
+	config.ArtifactoryURL = strings.TrimSuffix(getEnvFunc("ARTIFACTORY_URL"), "/")
+	config.ArtifactoryRepository = getEnvFunc("ARTIFACTORY_REPOSITORY")
+
+	return nil
+}
+
+func (p *artifactoryProvider) Name() string {
+	return "artifactory"
+}
+
+// LatestVersion returns the pinned tag from IMAGE_BASE or discovers the
+// newest tag with the configured discovery method.
+func (p *artifactoryProvider) LatestVersion(ctx context.Context) (string, error) {
+	if p.pinnedTag != "" {
+		return p.pinnedTag, nil
+	}
+
+	if p.config.ArtifactoryDiscovery == ArtifactoryDiscoveryAQL {
+		return p.latestFromAQL(ctx)
+	}
+
+	return latestListedTag(ctx, p.config, p, p.repo)
+}
+
+// artifactoryLocation returns the Artifactory base URL, repository key and
+// image path used for AQL queries. Unless overridden by ARTIFACTORY_URL and
+// ARTIFACTORY_REPOSITORY they are derived from IMAGE_BASE assuming the
+// repository path access method (<host>/<repo-key>/<image>).
+func (p *artifactoryProvider) artifactoryLocation() (baseURL, repoKey, imagePath string, err error) {
+	baseURL = p.config.ArtifactoryURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("%s://%s/artifactory", p.repo.Scheme(), p.repo.RegistryStr())
+	}
+
+	repoKey = p.config.ArtifactoryRepository
+	imagePath = p.repo.RepositoryStr()
+	if repoKey == "" {
+		var found bool
+		repoKey, imagePath, found = strings.Cut(imagePath, "/")
+		if !found {
+			return "", "", "", fmt.Errorf("cannot derive Artifactory repository from %s; set ARTIFACTORY_REPOSITORY", p.repo.Name())
+		}
+	} else {
+		imagePath = strings.TrimPrefix(imagePath, repoKey+"/")
+	}
+
+	return baseURL, repoKey, imagePath, nil
+}
+
+// aqlResponse is the subset of an AQL search response used for discovery.
+type aqlResponse struct {
+	Results []struct {
+		Path     string    `json:"path"`
+		Modified time.Time `json:"modified"`
+	} `json:"results"`
+}
+
+// latestFromAQL finds every manifest.json below the image path and returns
+// the tag folder that was modified most recently, mirroring how the GitHub
+// provider picks the most recently updated version.
+func (p *artifactoryProvider) latestFromAQL(ctx context.Context) (string, error) {
+	baseURL, repoKey, imagePath, err := p.artifactoryLocation()
+	if err != nil {
+		return "", err
+	}
+
+	query := fmt.Sprintf(`items.find({"repo":%q,"path":{"$match":%q},"name":"manifest.json"}).include("path","modified")`,
+		repoKey, imagePath+"/*")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/api/search/aql", bytes.NewBufferString(query))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	// AQL is served by the same Artifactory as the registry of IMAGE_BASE
+	cred, err := p.Credentials(ctx, p.repo.RegistryStr())
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(cred.Username, cred.Password)
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to make AQL request: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Warning: failed to close response body: %v", err)
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return "", fmt.Errorf("authentication failed (401): invalid ARTIFACTORY_USERNAME or ARTIFACTORY_PASSWORD")
+	case http.StatusForbidden:
+		return "", fmt.Errorf("access forbidden (403): user may lack read permission on %s", repoKey)
+	default:
+		return "", fmt.Errorf("artifactory AQL returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result aqlResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse AQL response: %w", err)
+	}
+
+	log.Printf("Found %d manifest(s) for %s in Artifactory repository %s\n", len(result.Results), imagePath, repoKey)
+
+	modified := map[string]time.Time{}
+	var tags []string
+	for _, item := range result.Results {
+		tag, found := strings.CutPrefix(item.Path, imagePath+"/")
+		if !found || tag == "" || strings.Contains(tag, "/") {
+			continue
+		}
+		modified[tag] = item.Modified
+		tags = append(tags, tag)
+	}
+
+	tags, err = filterCandidateTags(p.config, tags)
+	if err != nil {
+		return "", err
+	}
+
+	if p.config.VersionConstraint != "" {
+		return newestTag(tags, TagOrderSemver)
+	}
+
+	var latest string
+	for _, tag := range tags {
+		if latest == "" || modified[tag].After(modified[latest]) {
+			latest = tag
+		}
+	}
+
+	return latest, nil
+}
+
+// Reference returns the repository of IMAGE_BASE at version.
+func (p *artifactoryProvider) Reference(version string) (string, error) {
+	return referenceFor(p.repo, version), nil
+}
+
+// Credentials returns the credentials for registry: the static Artifactory
+// username and password when set and registry is the registry of
+// IMAGE_BASE, then those of ARTIFACTORY_DOCKER_CONFIG and finally those of
+// ARTIFACTORY_CREDENTIAL_HELPER.
+func (p *artifactoryProvider) Credentials(ctx context.Context, registry string) (Credential, error) {
+	if p.config.Username != "" && isImageRegistry(p.config, registry) {
+		return Credential{
+			Username: p.config.Username,
+			Password: p.config.Password,
+		}, nil
+	}
+
+	if p.dockerConfig != nil {
+		cred, ok, err := p.dockerConfig.credential(registry)
+		if err != nil {
+			return Credential{}, err
+		}
+		if ok {
+			return cred, nil
+		}
+	}
+
+	if p.config.ArtifactoryCredentialHelper != "" {
+		helper := execCredentialHelper{ctx: ctx, name: p.config.ArtifactoryCredentialHelper}
+		username, password, err := helper.Get(registry)
+		if errors.Is(err, errCredentialsNotFound) {
+			// Let the keychain fall through to the next source
+			return Credential{}, nil
+		}
+		if err != nil {
+			return Credential{}, fmt.Errorf("getting credentials for %s: %w", registry, err)
+		}
+		return Credential{Username: username, Password: password}, nil
+	}
+
+	return Credential{}, nil
+}
+
+// Pull copies the artifact into destDir with ORAS.
+func (p *artifactoryProvider) Pull(ctx context.Context, ref, destDir string) error {
+	log.Printf("Pulling image %s into %s using oras...\n", ref, destDir)
+	if err := pullWithOras(ctx, p.config, ref, destDir); err != nil {
+		return fmt.Errorf("oras pull failed: %w", err)
+	}
+	return nil
+}
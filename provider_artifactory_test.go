@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArtifactoryProviderPinnedTag(t *testing.T) {
+	testDigest := "sha256:" + strings.Repeat("ab", 32)
+	tests := []struct {
+		name       string
+		imageBase  string
+		wantPinned string
+	}{
+		{name: "tag", imageBase: "example.jfrog.io/docker-local/policies:1.0.0", wantPinned: "1.0.0"},
+		{name: "explicit latest", imageBase: "example.jfrog.io/docker-local/policies:latest", wantPinned: "latest"},
+		{name: "no tag", imageBase: "example.jfrog.io/docker-local/policies", wantPinned: ""},
+		{name: "port without tag", imageBase: "artifactory.local:8081/docker-local/policies", wantPinned: ""},
+		{name: "port with tag", imageBase: "artifactory.local:8081/docker-local/policies:1.0.0", wantPinned: "1.0.0"},
+		{name: "digest", imageBase: "example.jfrog.io/docker-local/policies@" + testDigest, wantPinned: testDigest},
+		{name: "tag and digest", imageBase: "example.jfrog.io/docker-local/policies:1.0.0@" + testDigest, wantPinned: testDigest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newArtifactoryProvider(&Config{ImageBase: tt.imageBase})
+			if err != nil {
+				t.Fatalf("newArtifactoryProvider() error = %v", err)
+			}
+			if p.pinnedTag != tt.wantPinned {
+				t.Errorf("pinnedTag = %q, want %q", p.pinnedTag, tt.wantPinned)
+			}
+		})
+	}
+}
+
+func TestArtifactoryProviderTagsDiscovery(t *testing.T) {
+	host := newTestRegistry(t)
+	repo := host + "/docker-local/policies"
+	for _, tag := range []string{"1.0.0", "1.2.0", "1.11.0", "latest"} {
+		pushPolicyImage(t, repo+":"+tag, newPolicyImage(t, testPolicyYAML))
+	}
+
+	config := &Config{
+		Provider:             "artifactory",
+		ImageBase:            repo,
+		Username:             "user",
+		Password:             "secret",
+		ArtifactoryDiscovery: ArtifactoryDiscoveryTags,
+	}
+	p, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+
+	latest, err := p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "1.11.0" {
+		t.Errorf("LatestVersion() = %q, want %q", latest, "1.11.0")
+	}
+
+	ref, err := p.Reference(latest)
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if want := repo + ":1.11.0"; ref != want {
+		t.Errorf("Reference() = %q, want %q", ref, want)
+	}
+}
+
+func TestArtifactoryProviderAQLDiscovery(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/artifactory/api/search/aql" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		gotQuery = string(body)
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]string{
+				{"path": "team/policies/1.0.0", "modified": "2024-01-01T10:00:00.000Z"},
+				{"path": "team/policies/hotfix", "modified": "2024-03-01T10:00:00.000Z"},
+				{"path": "team/policies/1.1.0", "modified": "2024-02-01T10:00:00.000Z"},
+				{"path": "team/policies/1.4.2", "modified": "2024-02-10T10:00:00.000Z"},
+				{"path": "team/policies/1.3.9", "modified": "2024-02-20T10:00:00.000Z"},
+				{"path": "team/policies/nested/1.0.0", "modified": "2024-05-01T10:00:00.000Z"},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	config := &Config{
+		Provider:             "artifactory",
+		ImageBase:            host + "/docker-local/team/policies",
+		Username:             "user",
+		Password:             "secret",
+		ArtifactoryDiscovery: ArtifactoryDiscoveryAQL,
+	}
+	p, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+
+	latest, err := p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "hotfix" {
+		t.Errorf("LatestVersion() = %q, want %q", latest, "hotfix")
+	}
+
+	for _, want := range []string{`"repo":"docker-local"`, `"$match":"team/policies/*"`, `"name":"manifest.json"`} {
+		if !strings.Contains(gotQuery, want) {
+			t.Errorf("AQL query %q should contain %q", gotQuery, want)
+		}
+	}
+
+	// A constraint selects the highest satisfying version, not the newest push
+	config.VersionConstraint = "^1"
+	if latest, err := p.LatestVersion(context.Background()); err != nil || latest != "1.4.2" {
+		t.Errorf("LatestVersion() with VERSION_CONSTRAINT = %q, %v, want %q", latest, err, "1.4.2")
+	}
+	config.VersionConstraint = ""
+
+	config.Password = "wrong"
+	if _, err := p.LatestVersion(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("LatestVersion() with bad credentials error = %v, want 401 error", err)
+	}
+}
+
+func TestArtifactoryLocation(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		wantBaseURL   string
+		wantRepoKey   string
+		wantImagePath string
+		wantErr       bool
+	}{
+		{
+			name:          "derived from repository path",
+			config:        Config{ImageBase: "example.jfrog.io/docker-local/team/policies"},
+			wantBaseURL:   "https://example.jfrog.io/artifactory",
+			wantRepoKey:   "docker-local",
+			wantImagePath: "team/policies",
+		},
+		{
+			name: "explicit url and repository",
+			config: Config{
+				ImageBase:             "docker-local.example.jfrog.io/team/policies",
+				ArtifactoryURL:        "https://example.jfrog.io/artifactory",
+				ArtifactoryRepository: "docker-local",
+			},
+			wantBaseURL:   "https://example.jfrog.io/artifactory",
+			wantRepoKey:   "docker-local",
+			wantImagePath: "team/policies",
+		},
+		{
+			name:    "single path segment",
+			config:  Config{ImageBase: "docker-local.example.jfrog.io/policies"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newArtifactoryProvider(&tt.config)
+			if err != nil {
+				t.Fatalf("newArtifactoryProvider() error = %v", err)
+			}
+
+			baseURL, repoKey, imagePath, err := p.artifactoryLocation()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("artifactoryLocation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if baseURL != tt.wantBaseURL || repoKey != tt.wantRepoKey || imagePath != tt.wantImagePath {
+				t.Errorf("artifactoryLocation() = (%q, %q, %q), want (%q, %q, %q)",
+					baseURL, repoKey, imagePath, tt.wantBaseURL, tt.wantRepoKey, tt.wantImagePath)
+			}
+		})
+	}
+}
+
+func TestArtifactoryProviderCredentialSources(t *testing.T) {
+	helperDir := t.TempDir()
+	helper := `#!/bin/sh
+read server
+case "$server" in
+  unknown.example.com) echo 'credentials not found in native keychain'; exit 1 ;;
+  broken.example.com) echo 'keychain locked' >&2; exit 2 ;;
+  slow.example.com) exec sleep 10 ;;
+esac
+echo "{\"Username\":\"helper\",\"Secret\":\"for-$server\"}"
+`
+	if err := os.WriteFile(filepath.Join(helperDir, "docker-credential-test"), []byte(helper), 0755); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	t.Setenv("PATH", helperDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	pullSecret := writeTestDockerConfig(t, `{"auths":{"example.jfrog.io":{"username":"robot","password":"from-secret"}}}`)
+
+	tests := []struct {
+		name        string
+		config      Config
+		registry    string
+		want        Credential
+		errContains string
+	}{
+		{
+			name:     "static credentials win",
+			config:   Config{Username: "user", Password: "secret", ArtifactoryDockerConfig: pullSecret},
+			registry: "example.jfrog.io",
+			want:     Credential{Username: "user", Password: "secret"},
+		},
+		{
+			name:     "static credentials are not sent to mirrors",
+			config:   Config{Username: "user", Password: "secret", ArtifactoryDockerConfig: pullSecret, ArtifactoryCredentialHelper: "test"},
+			registry: "mirror.example.com",
+			want:     Credential{Username: "helper", Password: "for-mirror.example.com"},
+		},
+		{
+			name:     "pull secret",
+			config:   Config{ArtifactoryDockerConfig: pullSecret, ArtifactoryCredentialHelper: "test"},
+			registry: "example.jfrog.io",
+			want:     Credential{Username: "robot", Password: "from-secret"},
+		},
+		{
+			name:     "credential helper for registries missing from the pull secret",
+			config:   Config{ArtifactoryDockerConfig: pullSecret, ArtifactoryCredentialHelper: "test"},
+			registry: "mirror.example.com",
+			want:     Credential{Username: "helper", Password: "for-mirror.example.com"},
+		},
+		{
+			name:     "registries unknown to the credential helper",
+			config:   Config{ArtifactoryDockerConfig: pullSecret, ArtifactoryCredentialHelper: "test"},
+			registry: "unknown.example.com",
+			want:     Credential{},
+		},
+		{
+			name:        "failing credential helper",
+			config:      Config{ArtifactoryCredentialHelper: "test"},
+			registry:    "broken.example.com",
+			errContains: "keychain locked",
+		},
+		{
+			name:     "no credentials",
+			config:   Config{ArtifactoryDockerConfig: pullSecret},
+			registry: "mirror.example.com",
+			want:     Credential{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.ImageBase = "example.jfrog.io/docker-local/policies"
+			p, err := newArtifactoryProvider(&config)
+			if err != nil {
+				t.Fatalf("newArtifactoryProvider() error = %v", err)
+			}
+
+			got, err := p.Credentials(context.Background(), tt.registry)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("Credentials() error = %v, want to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Credentials() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Credentials() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// A hung helper is killed when the sync times out
+	p, err := newArtifactoryProvider(&Config{ImageBase: "example.jfrog.io/docker-local/policies", ArtifactoryCredentialHelper: "test"})
+	if err != nil {
+		t.Fatalf("newArtifactoryProvider() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.Credentials(ctx, "slow.example.com"); err == nil {
+		t.Error("Credentials() error = nil, want the hung helper to be killed")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Credentials() returned after %v, want the context to stop the helper", elapsed)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	registerProvider("git", providerRegistration{
+		configure: configureGit,
+		build: func(config *Config) (Provider, error) {
+			return &gitProvider{
+				config:  config,
+				repoDir: filepath.Join(config.StateDir, "git"),
+			}, nil
+		},
+	})
+}
+
+// gitProvider follows a branch or the newest tag matching a pattern of a git
+// repository. Versions are commit SHAs, and the manifests below GIT_PATH of
+// that commit are applied. IMAGE_BASE is the repository URL.
+type gitProvider struct {
+	config *Config
+	// repoDir holds the local repository commits are fetched into
+	repoDir string
+	// latestSHA is the commit last returned by LatestVersion and latestRef
+	// the ref it was resolved from, which is what Pull fetches
+	latestSHA string
+	latestRef string
+	// caBundle is the CA bundle written for git when TLS_CA_FILE is set
+	caBundle string
+}
+
+// systemCABundles are the locations of the system CA bundle on common
+// distributions. git replaces rather than extends its trust store when
+// given a CA file, so the system roots are copied into the bundle.
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/cert.pem",
+}
+
+// configureGit validates the repository URL and reads the ref to follow.
+func configureGit(config *Config) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("git executable not found in PATH, required by the git provider")
+	}
+
+	u, err := url.Parse(config.ImageBase)
+	if err != nil || (u.Scheme != "file" && u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("IMAGE_BASE must be a file://, https:// or http:// git repository URL for the git provider, got: %s", config.ImageBase)
+	}
+
+	branch := strings.TrimSpace(getEnvFunc("GIT_BRANCH"))
+	tagPattern := strings.TrimSpace(getEnvFunc("GIT_TAG_PATTERN"))
+	if branch != "" && tagPattern != "" {
+		return errors.New("GIT_BRANCH and GIT_TAG_PATTERN are mutually exclusive")
+	}
+	if _, err := path.Match(tagPattern, ""); err != nil {
+		return fmt.Errorf("invalid GIT_TAG_PATTERN %q: %v", tagPattern, err)
+	}
+
+	username := strings.TrimSpace(getEnvFunc("GIT_USERNAME"))
+	password := strings.TrimSpace(getEnvFunc("GIT_PASSWORD"))
+	if username == "" && password != "" {
+		// Token-only hosts accept any username
+		username = "x-access-token"
+	}
+
+	tagOrder, err := loadTagOrder()
+	if err != nil {
+		return err
+	}
+
+	config.GitBranch = branch
+	config.GitTagPattern = tagPattern
+	config.GitPath = strings.Trim(filepath.ToSlash(getEnvFunc("GIT_PATH")), "/")
+	config.Username = username
+	config.Password = password
+	config.TagOrder = tagOrder
+
+	switch {
+	case tagPattern != "":
+		log.Printf("Following git tags matching %s in %s\n", tagPattern, u.Redacted())
+	case branch != "":
+		log.Printf("Following git branch %s of %s\n", branch, u.Redacted())
+	default:
+		log.Printf("Following the default branch of %s\n", u.Redacted())
+	}
+
+	return nil
+}
+
+func (p *gitProvider) Name() string {
+	return "git"
+}
+
+// LatestVersion returns the commit SHA the followed branch or newest matching
+// tag points to, without cloning the repository.
+func (p *gitProvider) LatestVersion(ctx context.Context) (string, error) {
+	config := p.config
+
+	if config.GitTagPattern == "" {
+		ref := "HEAD"
+		if config.GitBranch != "" {
+			ref = "refs/heads/" + config.GitBranch
+		}
+		refs, err := p.lsRemote(ctx, false, ref)
+		if err != nil {
+			return "", err
+		}
+		sha, ok := refs[ref]
+		if !ok {
+			return "", fmt.Errorf("ref %s not found in %s", ref, p.redactedURL())
+		}
+		p.latestSHA, p.latestRef = sha, ref
+		return sha, nil
+	}
+
+	refs, err := p.lsRemote(ctx, true)
+	if err != nil {
+		return "", err
+	}
+
+	var tags []string
+	for ref := range refs {
+		tag, ok := strings.CutPrefix(ref, "refs/tags/")
+		if !ok {
+			continue
+		}
+		if matched, _ := path.Match(config.GitTagPattern, tag); matched {
+			tags = append(tags, tag)
+		}
+	}
+
+	tags, err = filterCandidateTags(config, tags)
+	if err != nil {
+		return "", err
+	}
+	order := config.TagOrder
+	if order == "" {
+		order = TagOrderSemver
+	}
+	tag, err := newestTag(tags, order)
+	if err != nil || tag == "" {
+		return "", err
+	}
+
+	ref := "refs/tags/" + tag
+	sha := refs[ref]
+	log.Printf("Newest git tag is %s (commit %s)\n", tag, sha)
+	p.latestSHA, p.latestRef = sha, ref
+	return sha, nil
+}
+
+// lsRemote lists the remote refs matching patterns, or only tags, as a map
+// of ref name to commit SHA. Annotated tags are resolved to the commit they
+// point to.
+func (p *gitProvider) lsRemote(ctx context.Context, tagsOnly bool, patterns ...string) (map[string]string, error) {
+	args := []string{"ls-remote"}
+	if tagsOnly {
+		args = append(args, "--tags")
+	}
+	args = append(args, p.config.ImageBase)
+	args = append(args, patterns...)
+
+	out, err := p.git(ctx, "", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := map[string]string{}
+	peeled := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		sha, ref, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if base, isPeeled := strings.CutSuffix(ref, "^{}"); isPeeled {
+			peeled[base] = sha
+			continue
+		}
+		refs[ref] = sha
+	}
+	for ref, sha := range peeled {
+		refs[ref] = sha
+	}
+
+	return refs, nil
+}
+
+// Reference returns the repository URL at the commit.
+func (p *gitProvider) Reference(version string) (string, error) {
+	return p.redactedURL() + "@" + version, nil
+}
+
+// refCommit returns the commit of a reference built by Reference. The URL
+// may itself contain @ in its user info, so the last @ separates the commit.
+func refCommit(ref string) (string, error) {
+	i := strings.LastIndex(ref, "@")
+	if i < 0 || i == len(ref)-1 {
+		return "", fmt.Errorf("invalid git reference %q", ref)
+	}
+	return ref[i+1:], nil
+}
+
+// Credentials returns no registry credentials; GIT_USERNAME/GIT_PASSWORD
+// are passed to git directly.
+func (p *gitProvider) Credentials(ctx context.Context, registry string) (Credential, error) {
+	return Credential{}, nil
+}
+
+// Digest returns no digest; the commit SHA already identifies the content.
+func (p *gitProvider) Digest(ctx context.Context, ref string) (string, error) {
+	return "", nil
+}
+
+// Pull fetches the commit ref points to and exports GIT_PATH of it into
+// destDir.
+func (p *gitProvider) Pull(ctx context.Context, ref, destDir string) error {
+	sha, err := refCommit(ref)
+	if err != nil {
+		return err
+	}
+	if sha != p.latestSHA {
+		return fmt.Errorf("commit %s is not the one last returned by LatestVersion", sha)
+	}
+	remoteRef := p.latestRef
+
+	if _, err := os.Stat(filepath.Join(p.repoDir, "HEAD")); err != nil {
+		if err := os.MkdirAll(p.repoDir, 0755); err != nil {
+			return err
+		}
+		if _, err := p.git(ctx, p.repoDir, "init", "--bare", "--quiet"); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Fetching %s of %s ...\n", remoteRef, p.redactedURL())
+	if _, err := p.git(ctx, p.repoDir, "fetch", "--quiet", "--depth", "1", "--no-tags", p.config.ImageBase, remoteRef); err != nil {
+		return err
+	}
+
+	treeish := sha
+	if p.config.GitPath != "" {
+		treeish = sha + ":" + p.config.GitPath
+	}
+	archive := filepath.Join(p.repoDir, "export.tar")
+	defer func() {
+		if err := os.Remove(archive); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: failed to remove %s: %v", archive, err)
+		}
+	}()
+	if _, err := p.git(ctx, p.repoDir, "archive", "--format=tar", "-o", archive, treeish); err != nil {
+		return fmt.Errorf("exporting commit %s (the ref may have moved since it was resolved): %w", sha, err)
+	}
+
+	return extractArchive(archive, destDir, nil)
+}
+
+// git runs a git command in dir and returns its standard output. Credentials
+// and the TLS and proxy settings are passed through the environment so they
+// do not appear in arguments.
+func (p *gitProvider) git(ctx context.Context, dir string, args ...string) (string, error) {
+	gitConfig, err := p.gitConfig()
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(gitConfig)))
+	for i, kv := range gitConfig {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, kv[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, kv[1]))
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
+
+// gitConfig returns the git configuration for authentication, TLS_CA_FILE,
+// the TLS client certificate and the proxy of the repository URL.
+func (p *gitProvider) gitConfig() ([][2]string, error) {
+	config := p.config
+
+	var gitConfig [][2]string
+	if config.Password != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(config.Username + ":" + config.Password))
+		gitConfig = append(gitConfig, [2]string{"http.extraHeader", "Authorization: Basic " + auth})
+	}
+
+	if len(config.TLSCAFiles) > 0 {
+		bundle, err := p.writeCABundle()
+		if err != nil {
+			return nil, err
+		}
+		gitConfig = append(gitConfig, [2]string{"http.sslCAInfo", bundle})
+	}
+	if config.TLSClientCertFile != "" {
+		gitConfig = append(gitConfig,
+			[2]string{"http.sslCert", config.TLSClientCertFile},
+			[2]string{"http.sslKey", config.TLSClientKeyFile},
+		)
+	}
+
+	if u, err := url.Parse(config.ImageBase); err == nil {
+		proxy := config.HTTPProxy
+		if u.Scheme == "https" {
+			proxy = config.HTTPSProxy
+		}
+		if proxy != "" && useProxy(config, u.Host) {
+			gitConfig = append(gitConfig, [2]string{"http.proxy", proxy})
+		}
+	}
+
+	return gitConfig, nil
+}
+
+// writeCABundle writes the system roots and TLS_CA_FILE into one bundle
+// next to the repository, once.
+func (p *gitProvider) writeCABundle() (string, error) {
+	if p.caBundle != "" {
+		return p.caBundle, nil
+	}
+
+	var bundle []byte
+	for _, system := range systemCABundles {
+		if pem, err := os.ReadFile(system); err == nil {
+			bundle = append(bundle, pem...)
+			break
+		}
+	}
+	for _, file := range p.config.TLSCAFiles {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("reading TLS_CA_FILE %s: %w", file, err)
+		}
+		bundle = append(append(bundle, '\n'), pem...)
+	}
+
+	path := filepath.Join(filepath.Dir(p.repoDir), "git-ca-bundle.pem")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, bundle, 0644); err != nil {
+		return "", fmt.Errorf("writing CA bundle for git: %w", err)
+	}
+	p.caBundle = path
+
+	return path, nil
+}
+
+// redactedURL returns the repository URL without any embedded password.
+func (p *gitProvider) redactedURL() string {
+	u, err := url.Parse(p.config.ImageBase)
+	if err != nil {
+		return p.config.ImageBase
+	}
+	return u.Redacted()
+}
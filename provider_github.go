@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func init() {
+	registerProvider("github", providerRegistration{
+		configure: configureGitHub,
+		build: func(config *Config) (Provider, error) {
+			return newGitHubProvider(config)
+		},
+	})
+}
+
+const (
+	// githubAPIBaseURL is the public GitHub REST API
+	githubAPIBaseURL = "https://api.github.com"
+	// githubRegistryHost is the public GitHub container registry
+	githubRegistryHost = "ghcr.io"
+	// githubTokenUsername is the registry username presented with GitHub
+	// tokens; GHCR only checks the token
+	githubTokenUsername = "x-access-token"
+	// githubVersionsPerPage is the page size requested from the versions API
+	githubVersionsPerPage = 100
+	// maxGitHubVersionPages bounds how many pages of versions are fetched per poll
+	maxGitHubVersionPages = 10
+)
+
+// githubProvider discovers versions through the GitHub Packages REST API and
+// pulls them from GHCR.
+type githubProvider struct {
+	config     *Config
+	client     *http.Client
+	apiBaseURL string
+
+	// appKey is set in GitHub App mode; installation tokens are cached
+	// in appToken until appTokenExpiry
+	appKey         *rsa.PrivateKey
+	mu             sync.Mutex
+	appToken       string
+	appTokenExpiry time.Time
+
+	// pages caches the last response of each versions page for conditional
+	// requests, versions the result of the last complete listing
+	pages    map[string]githubCachedPage
+	versions []GitHubPackageVersion
+	// rateLimit is the budget reported by the last response; no requests
+	// are made before notBefore
+	rateLimit githubRateLimit
+	notBefore time.Time
+}
+
+// githubCachedPage is a versions page kept for If-None-Match requests.
+type githubCachedPage struct {
+	etag     string
+	versions []GitHubPackageVersion
+	link     string
+}
+
+func newGitHubProvider(config *Config) (*githubProvider, error) {
+	p := &githubProvider{
+		config:     config,
+		client:     &http.Client{Transport: httpTransport(config)},
+		apiBaseURL: config.GithubAPIURL,
+	}
+	if p.apiBaseURL == "" {
+		p.apiBaseURL = githubAPIBaseURL
+	}
+
+	if config.GithubAppID != "" {
+		key, err := loadGitHubAppKey(config.GithubAppPrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		p.appKey = key
+	}
+
+	return p, nil
+}
+
+// configureGitHub reads the GitHub token or GitHub App settings and derives
+// owner and package from IMAGE_BASE.
+func configureGitHub(config *Config) error {
+	if err := configureGitHubAuth(config); err != nil {
+		return err
+	}
+
+	if err := loadImageReference(config); err != nil {
+		return err
+	}
+
+	// Parse IMAGE_BASE to extract owner and package
+	// Expected format: ghcr.io/owner/package or ghcr.io/owner/package:tag
+	owner, packageName, err := parseImageBase(config.ImageBase)
+	if err != nil {
+		return fmt.Errorf("failed to parse IMAGE_BASE: %v", err)
+	}
+
+	config.Owner = owner
+	config.Package = packageName
+	// Normalize package name for API path
+	config.PackageNormalized = strings.ReplaceAll(packageName, "/", "%2F")
+	config.GithubAPIOwnerType = getEnvOrDefault("GITHUB_API_OWNER_TYPE", "users")
+
+	apiURL, err := githubAPIURL(config.ImageBase)
+	if err != nil {
+		return err
+	}
+	config.GithubAPIURL = apiURL
+
+	log.Printf("Using GHCR package (owner=%s, package=%s)\n", owner, packageName)
+	log.Printf("Using GitHub API at %s\n", apiURL)
+
+	return nil
+}
+
+// githubAPIURL returns GITHUB_API_URL when set and otherwise derives the REST
+// API base URL from the registry host of IMAGE_BASE:
+//
+//	ghcr.io                      -> https://api.github.com
+//	containers.ghe.example.com   -> https://ghe.example.com/api/v3 (GHES)
+//	containers.acme.ghe.com      -> https://api.acme.ghe.com (GHE.com)
+func githubAPIURL(imageBase string) (string, error) {
+	if raw := strings.TrimSpace(getEnvFunc("GITHUB_API_URL")); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", fmt.Errorf("invalid GITHUB_API_URL: %s (must be an http(s) URL such as https://ghe.example.com/api/v3)", raw)
+		}
+		return strings.TrimSuffix(u.String(), "/"), nil
+	}
+
+	ref, err := name.ParseReference(imageBase)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse IMAGE_BASE: %v", err)
+	}
+	registry := ref.Context().Registry
+
+	host := registry.RegistryStr()
+	if host == githubRegistryHost {
+		return githubAPIBaseURL, nil
+	}
+
+	// GHES with subdomain isolation serves the registry on containers.<host>
+	host = strings.TrimPrefix(host, "containers.")
+	if strings.HasSuffix(host, ".ghe.com") {
+		return fmt.Sprintf("%s://api.%s", registry.Scheme(), host), nil
+	}
+	return fmt.Sprintf("%s://%s/api/v3", registry.Scheme(), host), nil
+}
+
+// configureGitHubAuth selects GitHub App authentication when GITHUB_APP_ID is
+// set and falls back to the GITHUB_TOKEN personal access token otherwise.
+func configureGitHubAuth(config *Config) error {
+	appID := strings.TrimSpace(getEnvFunc("GITHUB_APP_ID"))
+	if appID != "" {
+		installationID := strings.TrimSpace(getEnvFunc("GITHUB_APP_INSTALLATION_ID"))
+		keyFile := strings.TrimSpace(getEnvFunc("GITHUB_APP_PRIVATE_KEY_FILE"))
+		if installationID == "" || keyFile == "" {
+			return errors.New("GITHUB_APP_INSTALLATION_ID and GITHUB_APP_PRIVATE_KEY_FILE must be set when GITHUB_APP_ID is set")
+		}
+		if _, err := strconv.ParseInt(installationID, 10, 64); err != nil {
+			return fmt.Errorf("invalid GITHUB_APP_INSTALLATION_ID: %s (must be numeric)", installationID)
+		}
+		// Fail at startup rather than on the first poll
+		if _, err := loadGitHubAppKey(keyFile); err != nil {
+			return err
+		}
+
+		config.GithubAppID = appID
+		config.GithubAppInstallationID = installationID
+		config.GithubAppPrivateKeyFile = keyFile
+
+		log.Printf("Using GitHub App authentication (app=%s, installation=%s)\n", appID, installationID)
+
+		return nil
+	}
+
+	githubToken := strings.TrimSpace(getEnvFunc("GITHUB_TOKEN"))
+	if githubToken == "" {
+		return errors.New("GITHUB_TOKEN environment variable must be set (or GITHUB_APP_ID, GITHUB_APP_INSTALLATION_ID and GITHUB_APP_PRIVATE_KEY_FILE for GitHub App authentication)")
+	}
+
+	// Validate token format - GitHub tokens should only contain alphanumeric and underscores
+	// Classic tokens start with ghp_, fine-grained with github_pat_
+	// Remove any non-printable characters that might cause header issues
+	githubToken = strings.Map(func(r rune) rune {
+		if r < 32 || r > 126 {
+			return -1 // Remove non-printable ASCII
+		}
+		return r
+	}, githubToken)
+
+	if githubToken == "" {
+		return errors.New("GITHUB_TOKEN contains only invalid characters")
+	}
+
+	// Log token prefix for debugging (don't log full token)
+	tokenPrefix := githubToken
+	if len(tokenPrefix) > 10 {
+		tokenPrefix = tokenPrefix[:10] + "..."
+	}
+	log.Printf("Using GitHub token: %s (length: %d)\n", tokenPrefix, len(githubToken))
+
+	config.GithubToken = githubToken
+
+	return nil
+}
+
+func (p *githubProvider) Name() string {
+	return "github"
+}
+
+// LatestVersion returns the preferred tag of the most recently updated
+// package version, falling back to its manifest digest when it is untagged.
+// Versions without a tag passing the tag filters are skipped. With a
+// VERSION_CONSTRAINT the highest satisfying semver tag across all versions
+// is returned instead.
+func (p *githubProvider) LatestVersion(ctx context.Context) (string, error) {
+	versions, err := p.listVersions(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(versions) == 0 {
+		return "", nil
+	}
+
+	var tags []string
+	for _, v := range versions {
+		tags = append(tags, v.Metadata.Container.Tags...)
+	}
+	candidates, err := filterCandidateTags(p.config, tags)
+	if err != nil {
+		return "", err
+	}
+
+	if p.config.VersionConstraint != "" {
+		return newestTag(candidates, TagOrderSemver)
+	}
+
+	allowed := make(map[string]bool, len(candidates))
+	for _, tag := range candidates {
+		allowed[tag] = true
+	}
+
+	// Find the most recently updated version that is still a candidate
+	var latest *GitHubPackageVersion
+	var latestTags []string
+	for i := range versions {
+		v := &versions[i]
+
+		var versionTags []string
+		for _, tag := range v.Metadata.Container.Tags {
+			if allowed[tag] {
+				versionTags = append(versionTags, tag)
+			}
+		}
+		// Skip versions whose tags were all filtered out; untagged versions
+		// can never match TAG_INCLUDE_REGEX
+		if len(versionTags) == 0 && (len(v.Metadata.Container.Tags) > 0 || p.config.TagIncludeRegex != "") {
+			continue
+		}
+
+		if latest == nil || v.UpdatedAt.After(latest.UpdatedAt) {
+			latest = v
+			latestTags = versionTags
+		}
+	}
+
+	if latest == nil {
+		return "", nil
+	}
+
+	// Prefer tag names if present
+	if len(latestTags) > 0 {
+		return preferredTag(latestTags), nil
+	}
+
+	// Untagged versions are pulled by the manifest digest held in the name
+	if !isDigest(latest.Name) {
+		return "", fmt.Errorf("untagged package version %d has no manifest digest (name=%q)", latest.ID, latest.Name)
+	}
+	log.Printf("Newest package version %d is untagged, using digest %s\n", latest.ID, latest.Name)
+	return latest.Name, nil
+}
+
+// listVersions fetches the package versions, following Link rel="next"
+// headers for up to maxGitHubVersionPages pages. Pages are requested with
+// If-None-Match so unchanged pages do not count against the rate limit, and
+// while the rate limit is low or exhausted the previous listing is reused.
+func (p *githubProvider) listVersions(ctx context.Context) ([]GitHubPackageVersion, error) {
+	config := p.config
+
+	if now := nowFunc(); now.Before(p.notBefore) {
+		if p.versions == nil {
+			return nil, fmt.Errorf("GitHub API rate limited until %s", p.notBefore.Format(time.RFC3339))
+		}
+		log.Printf("Conserving GitHub API rate limit, reusing previous versions until %s\n", p.notBefore.Format(time.RFC3339))
+		return p.versions, nil
+	}
+
+	next, err := url.Parse(fmt.Sprintf("%s/%s/%s/packages/container/%s/versions?per_page=%d",
+		p.apiBaseURL, config.GithubAPIOwnerType, config.Owner, config.PackageNormalized, githubVersionsPerPage))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build API URL: %w", err)
+	}
+
+	var versions []GitHubPackageVersion
+	pages := make(map[string]githubCachedPage)
+	for page := 1; next != nil; page++ {
+		if page > maxGitHubVersionPages {
+			log.Printf("Warning: package has more than %d pages of versions, only the first %d versions were considered\n",
+				maxGitHubVersionPages, len(versions))
+			break
+		}
+
+		cached, err := p.fetchVersionsPage(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		pages[next.String()] = cached
+		versions = append(versions, cached.versions...)
+
+		next, err = nextPageURL(next, cached.link)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.pages = pages
+	p.versions = versions
+	p.throttle()
+
+	return versions, nil
+}
+
+// throttle logs the remaining rate limit and, when it runs low, delays the
+// next request so the remaining budget lasts until the limit resets.
+func (p *githubProvider) throttle() {
+	rl := p.rateLimit
+	if rl.Limit == 0 {
+		return
+	}
+	log.Printf("GitHub API rate limit: %s\n", rl)
+
+	if !rl.low() {
+		return
+	}
+	now := nowFunc()
+	if delay := rl.spacing(now); delay > 0 {
+		p.notBefore = now.Add(delay)
+		log.Printf("Warning: GitHub API rate limit is low, next request after %s\n", p.notBefore.Format(time.RFC3339))
+	}
+}
+
+// fetchVersionsPage fetches a single page of package versions together with
+// the response's Link header, reusing the cached page on 304 Not Modified.
+func (p *githubProvider) fetchVersionsPage(ctx context.Context, apiURL *url.URL) (githubCachedPage, error) {
+	config := p.config
+
+	token, err := p.token(ctx)
+	if err != nil {
+		return githubCachedPage{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL.String(), nil)
+	if err != nil {
+		return githubCachedPage{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	cached, haveCached := p.pages[apiURL.String()]
+	if haveCached && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return githubCachedPage{}, fmt.Errorf("failed to make API request: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Warning: failed to close response body: %v", err)
+		}
+	}()
+
+	if rl, ok := parseGitHubRateLimit(resp.Header); ok {
+		p.rateLimit = rl
+	}
+
+	if resp.StatusCode == http.StatusNotModified && haveCached {
+		return cached, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return githubCachedPage{}, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Check for non-200 status codes
+	if resp.StatusCode != http.StatusOK {
+		var errMsg struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(body, &errMsg)
+
+		if until, limited := githubRateLimitedUntil(resp); limited {
+			p.notBefore = until
+			return githubCachedPage{}, fmt.Errorf("GitHub API rate limit exceeded (%d): retrying after %s. Message: %s",
+				resp.StatusCode, until.Format(time.RFC3339), errMsg.Message)
+		}
+
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			if p.appKey != nil {
+				return githubCachedPage{}, fmt.Errorf("authentication failed (401): GitHub App installation token was rejected. Message: %s", errMsg.Message)
+			}
+			return githubCachedPage{}, fmt.Errorf("authentication failed (401): invalid or expired GITHUB_TOKEN")
+		case http.StatusForbidden:
+			return githubCachedPage{}, fmt.Errorf("access forbidden (403): token may lack required permissions (read:packages). Message: %s", errMsg.Message)
+		case http.StatusNotFound:
+			return githubCachedPage{}, fmt.Errorf("package not found (404): owner=%s, package=%s (owner type: %s). Verify package exists and token has access",
+				config.Owner, config.Package, config.GithubAPIOwnerType)
+		default:
+			return githubCachedPage{}, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, errMsg.Message)
+		}
+	}
+
+	page := githubCachedPage{
+		etag: resp.Header.Get("ETag"),
+		link: resp.Header.Get("Link"),
+	}
+	if err := json.Unmarshal(body, &page.versions); err != nil {
+		return githubCachedPage{}, fmt.Errorf("failed to parse GitHub API response: %w. Response body: %s", err, string(body))
+	}
+
+	return page, nil
+}
+
+// Reference returns the repository of IMAGE_BASE at version, which is either
+// a tag or, for untagged versions, a manifest digest.
+func (p *githubProvider) Reference(version string) (string, error) {
+	repo, err := imageRepository(p.config)
+	if err != nil {
+		return "", fmt.Errorf("parsing IMAGE_BASE: %w", err)
+	}
+	return referenceFor(repo, version), nil
+}
+
+// Credentials returns GITHUB_TOKEN, or the installation token in GitHub App
+// mode, for the registry of IMAGE_BASE so private packages can be pulled
+// without a Docker config.
+func (p *githubProvider) Credentials(ctx context.Context, registry string) (Credential, error) {
+	// The token is only presented to the registry of IMAGE_BASE
+	if !isImageRegistry(p.config, registry) {
+		return Credential{}, nil
+	}
+
+	if p.appKey == nil {
+		if p.config.GithubToken == "" {
+			return Credential{}, nil
+		}
+		return Credential{Username: githubTokenUsername, Password: p.config.GithubToken}, nil
+	}
+
+	token, err := p.token(ctx)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{Username: githubTokenUsername, Password: token}, nil
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// githubTestDigest returns a fake manifest digest for a package version ID.
+func githubTestDigest(id int64) string {
+	return fmt.Sprintf("sha256:%064x", id)
+}
+
+// githubTestVersion builds a package version as returned by the GitHub API.
+func githubTestVersion(id int64, updated time.Time, tags ...string) GitHubPackageVersion {
+	v := GitHubPackageVersion{ID: id, Name: githubTestDigest(id), UpdatedAt: updated}
+	v.Metadata.Container.Tags = tags
+	return v
+}
+
+// newGitHubVersionsServer serves pages of package versions linked with Link
+// headers and counts the requests it receives.
+func newGitHubVersionsServer(t *testing.T, pages [][]GitHubPackageVersion, requests *int) *httptest.Server {
+	t.Helper()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+
+		if got := r.URL.EscapedPath(); got != "/orgs/owner/packages/container/team%2Fpolicies/versions" {
+			t.Errorf("unexpected path %q", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "token ghp_test" {
+			t.Errorf("Authorization = %q, want token header", got)
+		}
+		if got := r.URL.Query().Get("per_page"); got != "100" {
+			t.Errorf("per_page = %q, want 100", got)
+		}
+
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+		if page < len(pages) {
+			w.Header().Set("Link", fmt.Sprintf(
+				`<%s/orgs/owner/packages/container/team%%2Fpolicies/versions?per_page=100&page=%d>; rel="next", <%s/x?page=%d>; rel="last"`,
+				srv.URL, page+1, srv.URL, len(pages)))
+		}
+		_ = json.NewEncoder(w).Encode(pages[page-1])
+	}))
+
+	return srv
+}
+
+func mustGitHubProvider(t *testing.T, config *Config) *githubProvider {
+	t.Helper()
+	p, err := newGitHubProvider(config)
+	if err != nil {
+		t.Fatalf("newGitHubProvider() error = %v", err)
+	}
+	return p
+}
+
+func newTestGitHubProvider(t *testing.T, apiBaseURL string) *githubProvider {
+	t.Helper()
+	p := mustGitHubProvider(t, &Config{
+		GithubToken:        "ghp_test",
+		ImageBase:          "ghcr.io/owner/team/policies",
+		Owner:              "owner",
+		Package:            "team/policies",
+		PackageNormalized:  "team%2Fpolicies",
+		GithubAPIOwnerType: "orgs",
+	})
+	p.apiBaseURL = apiBaseURL
+	return p
+}
+
+func TestGitHubProviderFollowsPagination(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pages := [][]GitHubPackageVersion{
+		{githubTestVersion(1, base, "v1.0.0"), githubTestVersion(2, base.Add(time.Hour), "v1.1.0")},
+		{githubTestVersion(3, base.Add(2*time.Hour), "v1.2.0")},
+		{githubTestVersion(4, base.Add(5*time.Hour), "v2.0.0", "latest"), githubTestVersion(5, base.Add(3*time.Hour), "v1.3.0")},
+	}
+
+	requests := 0
+	srv := newGitHubVersionsServer(t, pages, &requests)
+	defer srv.Close()
+
+	latest, err := newTestGitHubProvider(t, srv.URL).LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "v2.0.0" {
+		t.Errorf("LatestVersion() = %q, want %q (newest version is on the last page)", latest, "v2.0.0")
+	}
+	if requests != len(pages) {
+		t.Errorf("requests = %d, want %d", requests, len(pages))
+	}
+}
+
+func TestGitHubProviderBoundsPagination(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pages := make([][]GitHubPackageVersion, maxGitHubVersionPages+5)
+	for i := range pages {
+		pages[i] = []GitHubPackageVersion{githubTestVersion(int64(i), base.Add(time.Duration(i)*time.Hour), fmt.Sprintf("v0.0.%d", i))}
+	}
+
+	requests := 0
+	srv := newGitHubVersionsServer(t, pages, &requests)
+	defer srv.Close()
+
+	latest, err := newTestGitHubProvider(t, srv.URL).LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if requests != maxGitHubVersionPages {
+		t.Errorf("requests = %d, want at most %d", requests, maxGitHubVersionPages)
+	}
+	if want := fmt.Sprintf("v0.0.%d", maxGitHubVersionPages-1); latest != want {
+		t.Errorf("LatestVersion() = %q, want %q", latest, want)
+	}
+}
+
+func TestGitHubProviderErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		errContains string
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, errContains: "authentication failed (401)"},
+		{name: "forbidden", status: http.StatusForbidden, errContains: "access forbidden (403)"},
+		{name: "not found", status: http.StatusNotFound, errContains: "package not found (404)"},
+		{name: "server error", status: http.StatusBadGateway, errContains: "GitHub API returned status 502"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"message":"nope"}`))
+			}))
+			defer srv.Close()
+
+			_, err := newTestGitHubProvider(t, srv.URL).LatestVersion(context.Background())
+			if err == nil || !contains(err.Error(), tt.errContains) {
+				t.Errorf("LatestVersion() error = %v, want to contain %q", err, tt.errContains)
+			}
+		})
+	}
+}
+
+func TestGitHubProviderVersionConstraint(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pages := [][]GitHubPackageVersion{{
+		githubTestVersion(1, base, "v1.4.0"),
+		githubTestVersion(2, base.Add(4*time.Hour), "v2.0.0", "latest"),
+		githubTestVersion(3, base.Add(time.Hour), "v1.4.2"),
+		githubTestVersion(4, base.Add(2*time.Hour), "v1.4.3-rc.1"),
+		githubTestVersion(5, base.Add(3*time.Hour)),
+	}}
+
+	requests := 0
+	srv := newGitHubVersionsServer(t, pages, &requests)
+	defer srv.Close()
+
+	p := newTestGitHubProvider(t, srv.URL)
+	p.config.VersionConstraint = "~1.4"
+
+	latest, err := p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "v1.4.2" {
+		t.Errorf("LatestVersion() = %q, want %q", latest, "v1.4.2")
+	}
+
+	p.config.IncludePrerelease = true
+	latest, err = p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "v1.4.3-rc.1" {
+		t.Errorf("LatestVersion() with prereleases = %q, want %q", latest, "v1.4.3-rc.1")
+	}
+}
+
+func TestGitHubProviderTagFilters(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pages := [][]GitHubPackageVersion{{
+		githubTestVersion(1, base, "v1.0.0"),
+		githubTestVersion(2, base.Add(time.Hour), "v1.1.0", "sha-aaa"),
+		githubTestVersion(3, base.Add(2*time.Hour), "pr-17"),
+		githubTestVersion(4, base.Add(3*time.Hour)),
+		githubTestVersion(5, base.Add(4*time.Hour), "sha-bbb", "pr-18"),
+	}}
+
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		want    string
+	}{
+		{name: "no filters follows newest version", want: "pr-18"},
+		{name: "exclude pr builds keeps newest remaining tag", exclude: `^pr-`, want: "sha-bbb"},
+		{name: "exclude pr and sha skips to untagged version", exclude: `^(pr|sha)-`, want: githubTestDigest(4)},
+		{name: "include releases skips untagged versions", include: `^v\d+\.\d+\.\d+$`, want: "v1.1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			srv := newGitHubVersionsServer(t, pages, &requests)
+			defer srv.Close()
+
+			p := newTestGitHubProvider(t, srv.URL)
+			p.config.TagIncludeRegex = tt.include
+			p.config.TagExcludeRegex = tt.exclude
+
+			latest, err := p.LatestVersion(context.Background())
+			if err != nil {
+				t.Fatalf("LatestVersion() error = %v", err)
+			}
+			if latest != tt.want {
+				t.Errorf("LatestVersion() = %q, want %q", latest, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHubProviderUntaggedVersion(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pages := [][]GitHubPackageVersion{{
+		githubTestVersion(1, base, "v1.0.0"),
+		githubTestVersion(2, base.Add(time.Hour)),
+	}}
+
+	requests := 0
+	srv := newGitHubVersionsServer(t, pages, &requests)
+	defer srv.Close()
+
+	p := newTestGitHubProvider(t, srv.URL)
+	latest, err := p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != githubTestDigest(2) {
+		t.Fatalf("LatestVersion() = %q, want digest %q", latest, githubTestDigest(2))
+	}
+
+	ref, err := p.Reference(latest)
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if want := "ghcr.io/owner/team/policies@" + githubTestDigest(2); ref != want {
+		t.Errorf("Reference() = %q, want %q", ref, want)
+	}
+}
+
+func TestGitHubProviderUntaggedVersionWithoutDigest(t *testing.T) {
+	pages := [][]GitHubPackageVersion{{{ID: 7, UpdatedAt: time.Now()}}}
+
+	requests := 0
+	srv := newGitHubVersionsServer(t, pages, &requests)
+	defer srv.Close()
+
+	_, err := newTestGitHubProvider(t, srv.URL).LatestVersion(context.Background())
+	if err == nil || !contains(err.Error(), "has no manifest digest") {
+		t.Errorf("LatestVersion() error = %v, want missing digest error", err)
+	}
+}
+
+func TestGitHubAPIURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		imageBase   string
+		apiURL      string
+		want        string
+		errContains string
+	}{
+		{
+			name:      "ghcr.io uses the public API",
+			imageBase: "ghcr.io/owner/policies",
+			want:      "https://api.github.com",
+		},
+		{
+			name:      "GHES with subdomain isolation",
+			imageBase: "containers.ghe.example.com/owner/policies:v1.0.0",
+			want:      "https://ghe.example.com/api/v3",
+		},
+		{
+			name:      "GHES without subdomain isolation",
+			imageBase: "ghe.example.com/owner/policies",
+			want:      "https://ghe.example.com/api/v3",
+		},
+		{
+			name:      "GHE.com data residency",
+			imageBase: "containers.acme.ghe.com/owner/policies",
+			want:      "https://api.acme.ghe.com",
+		},
+		{
+			name:      "explicit API URL wins",
+			imageBase: "registry.ghe.example.com/owner/policies",
+			apiURL:    "https://ghe.example.com/api/v3/",
+			want:      "https://ghe.example.com/api/v3",
+		},
+		{
+			name:        "invalid API URL",
+			imageBase:   "ghcr.io/owner/policies",
+			apiURL:      "ghe.example.com/api/v3",
+			errContains: "invalid GITHUB_API_URL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalGetEnvFunc := getEnvFunc
+			getEnvFunc = func(key string) string {
+				if key == "GITHUB_API_URL" {
+					return tt.apiURL
+				}
+				return ""
+			}
+			defer func() {
+				getEnvFunc = originalGetEnvFunc
+			}()
+
+			got, err := githubAPIURL(tt.imageBase)
+			if tt.errContains != "" {
+				if err == nil || !contains(err.Error(), tt.errContains) {
+					t.Errorf("githubAPIURL() error = %v, want to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("githubAPIURL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("githubAPIURL(%q) = %q, want %q", tt.imageBase, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHubProviderEnterpriseServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Path; got != "/api/v3/orgs/owner/packages/container/policies/versions" {
+			t.Errorf("unexpected path %q", got)
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]GitHubPackageVersion{githubTestVersion(1, time.Now(), "v1.2.0")})
+	}))
+	defer srv.Close()
+
+	env := map[string]string{
+		"GITHUB_TOKEN":          "ghp_test",
+		"GITHUB_API_URL":        srv.URL + "/api/v3",
+		"GITHUB_API_OWNER_TYPE": "orgs",
+	}
+	originalGetEnvFunc := getEnvFunc
+	getEnvFunc = func(key string) string {
+		return env[key]
+	}
+	defer func() {
+		getEnvFunc = originalGetEnvFunc
+	}()
+
+	config := &Config{ImageBase: "containers.ghe.example.com/owner/policies"}
+	if err := configureGitHub(config); err != nil {
+		t.Fatalf("configureGitHub() error = %v", err)
+	}
+	p := mustGitHubProvider(t, config)
+
+	latest, err := p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "v1.2.0" {
+		t.Errorf("LatestVersion() = %q, want %q", latest, "v1.2.0")
+	}
+
+	ref, err := p.Reference(latest)
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if want := "containers.ghe.example.com/owner/policies:v1.2.0"; ref != want {
+		t.Errorf("Reference() = %q, want %q", ref, want)
+	}
+}
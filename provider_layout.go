@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+// ociRefNameAnnotation names the tag of a manifest in an OCI layout index.json
+const ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+func init() {
+	registerProvider("layout", providerRegistration{
+		configure: configureLayout,
+		build: func(config *Config) (Provider, error) {
+			return &layoutProvider{config: config, path: config.ImageBase}, nil
+		},
+	})
+}
+
+// layoutProvider reads policy artifacts from an OCI image layout directory or
+// an oci-archive tarball (optionally gzip compressed) on a mounted volume, for
+// clusters without registry access. IMAGE_BASE is the path of the layout.
+type layoutProvider struct {
+	config *Config
+	path   string
+
+	// mu guards the extraction of an oci-archive, which is reused while the
+	// archive keeps its modification time and size
+	mu          sync.Mutex
+	archiveDir  string
+	archiveMod  time.Time
+	archiveSize int64
+}
+
+// configureLayout checks the layout path and reads the tag ordering.
+func configureLayout(config *Config) error {
+	if _, err := os.Stat(config.ImageBase); err != nil {
+		return fmt.Errorf("failed to access OCI layout %s: %v", config.ImageBase, err)
+	}
+
+	tagOrder, err := loadTagOrder()
+	if err != nil {
+		return err
+	}
+	config.TagOrder = tagOrder
+
+	log.Printf("Using OCI layout at %s\n", config.ImageBase)
+
+	return nil
+}
+
+func (p *layoutProvider) Name() string {
+	return "layout"
+}
+
+// LatestVersion returns the newest tag of the layout according to TAG_ORDER.
+// Layouts without any tagged manifest yield the digest of the manifest that
+// was added to index.json last.
+func (p *layoutProvider) LatestVersion(ctx context.Context) (string, error) {
+	var latest string
+	err := p.withIndex(func(idx v1.ImageIndex, manifests []v1.Descriptor) error {
+		var tags []string
+		for _, desc := range manifests {
+			if tag := layoutTag(desc); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+
+		if len(tags) == 0 {
+			if len(manifests) > 0 {
+				latest = manifests[len(manifests)-1].Digest.String()
+			}
+			return nil
+		}
+
+		candidates, err := filterCandidateTags(p.config, tags)
+		if err != nil {
+			return err
+		}
+		order := p.config.TagOrder
+		if order == "" {
+			order = TagOrderSemver
+		}
+		latest, err = newestTag(candidates, order)
+		return err
+	})
+
+	return latest, err
+}
+
+// Reference returns the layout path at version, using path@digest for
+// digests and path:tag otherwise.
+func (p *layoutProvider) Reference(version string) (string, error) {
+	if isDigest(version) {
+		return p.path + "@" + version, nil
+	}
+	return p.path + ":" + version, nil
+}
+
+// Credentials returns no credentials; layouts are read from disk.
+func (p *layoutProvider) Credentials(ctx context.Context, registry string) (Credential, error) {
+	return Credential{}, nil
+}
+
+// Digest returns the manifest digest ref points to in the layout.
+func (p *layoutProvider) Digest(ctx context.Context, ref string) (string, error) {
+	version, err := p.versionOf(ref)
+	if err != nil {
+		return "", err
+	}
+
+	var digest string
+	err = p.withIndex(func(idx v1.ImageIndex, manifests []v1.Descriptor) error {
+		desc, err := findLayoutManifest(manifests, version)
+		if err != nil {
+			return err
+		}
+		digest = desc.Digest.String()
+		return nil
+	})
+
+	return digest, err
+}
+
+// Pull extracts the image ref points to into destDir.
+func (p *layoutProvider) Pull(ctx context.Context, ref, destDir string) error {
+	version, err := p.versionOf(ref)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reading image %s into %s ...\n", ref, destDir)
+
+	return p.withIndex(func(idx v1.ImageIndex, manifests []v1.Descriptor) error {
+		desc, err := findLayoutManifest(manifests, version)
+		if err != nil {
+			return err
+		}
+
+		var img v1.Image
+		if desc.MediaType.IsIndex() {
+			child, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return fmt.Errorf("reading image index %s: %w", desc.Digest, err)
+			}
+			if img, err = selectImage(p.config, child); err != nil {
+				return err
+			}
+		} else if img, err = idx.Image(desc.Digest); err != nil {
+			return fmt.Errorf("reading image %s: %w", desc.Digest, err)
+		}
+
+		return extractImage(p.config, img, destDir)
+	})
+}
+
+// versionOf returns the tag or digest of a reference built by Reference.
+func (p *layoutProvider) versionOf(ref string) (string, error) {
+	rest, ok := strings.CutPrefix(ref, p.path)
+	if !ok || len(rest) < 2 || (rest[0] != ':' && rest[0] != '@') {
+		return "", fmt.Errorf("reference %q does not belong to OCI layout %s", ref, p.path)
+	}
+	return rest[1:], nil
+}
+
+// withIndex opens the layout, extracting archives on first use and whenever
+// they change, and passes its index and manifests to fn.
+func (p *layoutProvider) withIndex(fn func(idx v1.ImageIndex, manifests []v1.Descriptor) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return fmt.Errorf("accessing OCI layout: %w", err)
+	}
+
+	dir := p.path
+	if !info.IsDir() {
+		if dir, err = p.extractedArchive(info); err != nil {
+			return err
+		}
+	}
+
+	idx, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		return fmt.Errorf("reading OCI layout %s: %w", p.path, err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("reading index.json of %s: %w", p.path, err)
+	}
+
+	return fn(idx, manifest.Manifests)
+}
+
+// extractedArchive returns the directory the oci-archive is extracted to,
+// extracting it again when info shows it was replaced. The archive holds
+// whole artifacts, so MAX_ARTIFACT_SIZE rather than MAX_LAYER_SIZE bounds it.
+func (p *layoutProvider) extractedArchive(info os.FileInfo) (string, error) {
+	if p.archiveDir != "" && info.ModTime().Equal(p.archiveMod) && info.Size() == p.archiveSize {
+		return p.archiveDir, nil
+	}
+
+	dir, err := os.MkdirTemp("", "oci-archive-")
+	if err != nil {
+		return "", err
+	}
+	limits := newPullLimits(p.config)
+	limits.maxLayerSize = math.MaxInt64
+	if err := extractArchive(p.path, dir, limits); err != nil {
+		removeArchiveDir(dir)
+		return "", fmt.Errorf("extracting OCI archive %s: %w", p.path, err)
+	}
+
+	if p.archiveDir != "" {
+		removeArchiveDir(p.archiveDir)
+	}
+	p.archiveDir, p.archiveMod, p.archiveSize = dir, info.ModTime(), info.Size()
+	return dir, nil
+}
+
+func removeArchiveDir(dir string) {
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Warning: failed to remove directory %s: %v", dir, err)
+	}
+}
+
+// layoutTag returns the tag of a layout manifest. Reference names may be
+// plain tags ("v1.0.0") or full references ("registry/repo:v1.0.0").
+func layoutTag(desc v1.Descriptor) string {
+	refName := desc.Annotations[ociRefNameAnnotation]
+	if i := strings.LastIndex(refName, ":"); i >= 0 && !strings.Contains(refName[i:], "/") {
+		return refName[i+1:]
+	}
+	return refName
+}
+
+// findLayoutManifest returns the manifest tagged or identified by version.
+// For tags present more than once, the last entry of index.json wins.
+func findLayoutManifest(manifests []v1.Descriptor, version string) (v1.Descriptor, error) {
+	digest := isDigest(version)
+	for i := len(manifests) - 1; i >= 0; i-- {
+		desc := manifests[i]
+		if (digest && desc.Digest.String() == version) || (!digest && layoutTag(desc) == version) {
+			return desc, nil
+		}
+	}
+	return v1.Descriptor{}, fmt.Errorf("version %s not found in OCI layout", version)
+}
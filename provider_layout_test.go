@@ -0,0 +1,271 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+// appendLayoutImage adds a policy image to the layout at dir, tagged when tag
+// is not empty, and returns its digest.
+func appendLayoutImage(t *testing.T, dir, tag, policy string) string {
+	t.Helper()
+
+	lp, err := layout.FromPath(dir)
+	if err != nil {
+		lp, err = layout.Write(dir, empty.Index)
+		if err != nil {
+			t.Fatalf("layout.Write() error = %v", err)
+		}
+	}
+
+	var opts []layout.Option
+	if tag != "" {
+		opts = append(opts, layout.WithAnnotations(map[string]string{ociRefNameAnnotation: tag}))
+	}
+	img := newPolicyImage(t, policy)
+	if err := lp.AppendImage(img, opts...); err != nil {
+		t.Fatalf("AppendImage() error = %v", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() error = %v", err)
+	}
+	return digest.String()
+}
+
+// writeTestArchive packs dir into a gzip compressed oci-archive.
+func writeTestArchive(t *testing.T, dir string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "policies.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := tw.AddFS(os.DirFS(dir)); err != nil {
+		t.Fatalf("AddFS() error = %v", err)
+	}
+	for _, c := range []interface{ Close() error }{tw, gz, f} {
+		if err := c.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	return path
+}
+
+func TestLayoutProvider(t *testing.T) {
+	dir := t.TempDir()
+	appendLayoutImage(t, dir, "v1.0.0", testPolicyYAML)
+	want := appendLayoutImage(t, dir, "registry.example.com/policies:v1.2.0", testPolicyYAML+"    # v1.2.0\n")
+	appendLayoutImage(t, dir, "v1.1.0", testPolicyYAML)
+	appendLayoutImage(t, dir, "latest", testPolicyYAML)
+
+	paths := map[string]string{
+		"directory": dir,
+		"archive":   writeTestArchive(t, dir),
+	}
+
+	for name, path := range paths {
+		t.Run(name, func(t *testing.T) {
+			p := &layoutProvider{config: &Config{TagOrder: TagOrderSemver}, path: path}
+			ctx := context.Background()
+
+			latest, err := p.LatestVersion(ctx)
+			if err != nil {
+				t.Fatalf("LatestVersion() error = %v", err)
+			}
+			if latest != "v1.2.0" {
+				t.Fatalf("LatestVersion() = %q, want %q", latest, "v1.2.0")
+			}
+
+			ref, err := p.Reference(latest)
+			if err != nil {
+				t.Fatalf("Reference() error = %v", err)
+			}
+			digest, err := p.Digest(ctx, ref)
+			if err != nil {
+				t.Fatalf("Digest() error = %v", err)
+			}
+			if digest != want {
+				t.Errorf("Digest() = %q, want %q", digest, want)
+			}
+
+			destDir := t.TempDir()
+			if err := p.Pull(ctx, ref, destDir); err != nil {
+				t.Fatalf("Pull() error = %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(destDir, "policy-0.yaml"))
+			if err != nil {
+				t.Fatalf("reading pulled policy: %v", err)
+			}
+			if !strings.Contains(string(data), "# v1.2.0") {
+				t.Errorf("pulled policy = %q, want the v1.2.0 content", data)
+			}
+		})
+	}
+}
+
+func TestLayoutProviderUntagged(t *testing.T) {
+	dir := t.TempDir()
+	appendLayoutImage(t, dir, "", testPolicyYAML)
+	want := appendLayoutImage(t, dir, "", testPolicyYAML+"    # newer\n")
+
+	p := &layoutProvider{config: &Config{}, path: dir}
+	latest, err := p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != want {
+		t.Errorf("LatestVersion() = %q, want digest of the last manifest %q", latest, want)
+	}
+
+	ref, err := p.Reference(latest)
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if ref != dir+"@"+want {
+		t.Errorf("Reference() = %q, want %q", ref, dir+"@"+want)
+	}
+}
+
+func TestLayoutProviderWatchLoop(t *testing.T) {
+	originalApplyManifestsFunc := applyManifestsFunc
+	var applied []string
+	applyManifestsFunc = func(config *Config, dir string) error {
+		files, err := findYAMLFiles(dir)
+		applied = append(applied, files...)
+		return err
+	}
+	defer func() {
+		applyManifestsFunc = originalApplyManifestsFunc
+	}()
+
+	dir := t.TempDir()
+	appendLayoutImage(t, dir, "v1.0.0", testPolicyYAML)
+
+	stateDir := t.TempDir()
+	config := &Config{
+		Name:      "layout-test",
+		Provider:  "layout",
+		ImageBase: dir,
+		StateDir:  stateDir,
+		LastFile:  filepath.Join(stateDir, "last_seen"),
+	}
+
+	if err := watchLoop(context.Background(), config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+	appendLayoutImage(t, dir, "v1.1.0", testPolicyYAML+"    # v1.1.0\n")
+	if err := watchLoop(context.Background(), config); err != nil {
+		t.Fatalf("watchLoop() error = %v", err)
+	}
+
+	state, err := readState(config.LastFile)
+	if err != nil {
+		t.Fatalf("readState() error = %v", err)
+	}
+	if state.Tag != "v1.1.0" || !isDigest(state.Digest) {
+		t.Errorf("state = %+v, want v1.1.0 with digest", state)
+	}
+	if len(applied) != 2 {
+		t.Errorf("applied = %v, want one policy per new version", applied)
+	}
+}
+
+func TestExtractArchiveRejectsTraversal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evil.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	tw := tar.NewWriter(f)
+	content := []byte("owned")
+	if err := tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatalf("WriteHeader() error = %v", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "out")
+	err = extractArchive(path, dir, nil)
+	if err == nil || !strings.Contains(err.Error(), "escapes the extraction directory") {
+		t.Errorf("extractArchive() error = %v, want traversal error", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil")); !os.IsNotExist(err) {
+		t.Errorf("file outside the extraction directory was written: %v", err)
+	}
+}
+
+func TestLayoutProviderReusesExtractedArchive(t *testing.T) {
+	dir := t.TempDir()
+	appendLayoutImage(t, dir, "v1.0.0", testPolicyYAML)
+	path := writeTestArchive(t, dir)
+
+	p := &layoutProvider{config: &Config{TagOrder: TagOrderSemver}, path: path}
+	ctx := context.Background()
+	if _, err := p.LatestVersion(ctx); err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	extracted := p.archiveDir
+	if _, err := p.Digest(ctx, path+":v1.0.0"); err != nil {
+		t.Fatalf("Digest() error = %v", err)
+	}
+	if p.archiveDir != extracted {
+		t.Errorf("archive extracted again to %s although it did not change", p.archiveDir)
+	}
+
+	// A replaced archive is extracted again and the old extraction removed
+	appendLayoutImage(t, dir, "v1.1.0", testPolicyYAML)
+	if err := os.Rename(writeTestArchive(t, dir), path); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	latest, err := p.LatestVersion(ctx)
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "v1.1.0" {
+		t.Errorf("LatestVersion() = %q after the archive changed, want v1.1.0", latest)
+	}
+	if _, err := os.Stat(extracted); !os.IsNotExist(err) {
+		t.Errorf("previous extraction %s was not removed: %v", extracted, err)
+	}
+	removeArchiveDir(p.archiveDir)
+}
+
+func TestLayoutProviderArchiveLimits(t *testing.T) {
+	dir := t.TempDir()
+	appendLayoutImage(t, dir, "v1.0.0", testPolicyYAML)
+	path := writeTestArchive(t, dir)
+
+	for name, config := range map[string]*Config{
+		"MAX_ARTIFACT_SIZE": {MaxArtifactSize: 64},
+		"MAX_FILES":         {MaxFiles: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := &layoutProvider{config: config, path: path}
+			_, err := p.LatestVersion(context.Background())
+			if !errors.Is(err, errPullLimit) || !strings.Contains(err.Error(), name) {
+				t.Errorf("LatestVersion() error = %v, want a %s pull limit error", err, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func init() {
+	registerProvider("oci", providerRegistration{
+		configure: configureOCI,
+		build: func(config *Config) (Provider, error) {
+			return newOCIProvider(config)
+		},
+	})
+}
+
+// ociProvider discovers versions of any OCI distribution compliant registry
+// (Harbor, Zot, registry:2, ...) through the /v2/<name>/tags/list API.
+type ociProvider struct {
+	config *Config
+	repo   name.Repository
+}
+
+func newOCIProvider(config *Config) (*ociProvider, error) {
+	repo, err := imageRepository(config)
+	if err != nil {
+		return nil, fmt.Errorf("parsing IMAGE_BASE: %w", err)
+	}
+
+	return &ociProvider{
+		config: config,
+		repo:   repo,
+	}, nil
+}
+
+// configureOCI reads the optional registry credentials and the tag ordering.
+func configureOCI(config *Config) error {
+	if err := loadImageReference(config); err != nil {
+		return err
+	}
+
+	username := strings.TrimSpace(getEnvFunc("REGISTRY_USERNAME"))
+	password := strings.TrimSpace(getEnvFunc("REGISTRY_PASSWORD"))
+	if (username == "") != (password == "") {
+		return errors.New("REGISTRY_USERNAME and REGISTRY_PASSWORD must be set together")
+	}
+	if username != "" {
+		log.Printf("Using registry username: %s\n", username)
+	}
+
+	tagOrder, err := loadTagOrder()
+	if err != nil {
+		return err
+	}
+
+	config.Username = username
+	config.Password = password
+	config.TagOrder = tagOrder
+
+	return nil
+}
+
+func (p *ociProvider) Name() string {
+	return "oci"
+}
+
+// LatestVersion lists the repository tags and returns the newest one
+// according to TAG_ORDER.
+func (p *ociProvider) LatestVersion(ctx context.Context) (string, error) {
+	return latestListedTag(ctx, p.config, p, p.repo)
+}
+
+// Reference returns the repository of IMAGE_BASE at version.
+func (p *ociProvider) Reference(version string) (string, error) {
+	return referenceFor(p.repo, version), nil
+}
+
+// Credentials returns REGISTRY_USERNAME/REGISTRY_PASSWORD when set and
+// registry is the registry of IMAGE_BASE. Mirrors authenticate through the
+// other REGISTRY_KEYCHAIN entries.
+func (p *ociProvider) Credentials(ctx context.Context, registry string) (Credential, error) {
+	if !isImageRegistry(p.config, registry) {
+		return Credential{}, nil
+	}
+	return Credential{
+		Username: p.config.Username,
+		Password: p.config.Password,
+	}, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+)
+
+const testPolicyYAML = `apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: require-labels
+spec:
+  rules:
+  - name: check
+`
+
+// newPolicyImage builds an OCI artifact with one Kyverno policy layer per
+// policy.
+func newPolicyImage(t *testing.T, policies ...string) v1.Image {
+	t.Helper()
+	img := empty.Image
+	for _, policy := range policies {
+		var err error
+		img, err = mutate.Append(img, mutate.Addendum{
+			Layer: static.NewLayer([]byte(policy), PolicyLayerMediaType),
+		})
+		if err != nil {
+			t.Fatalf("building image: %v", err)
+		}
+	}
+	return img
+}
+
+// newTestRegistry starts an in-memory registry and returns its host. wrap,
+// when given, intercepts requests before they reach the registry.
+func newTestRegistry(t *testing.T, wrap ...func(http.Handler) http.Handler) string {
+	t.Helper()
+	var handler http.Handler = registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	for _, w := range wrap {
+		handler = w(handler)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+// pushPolicyImage pushes img to ref on the test registry.
+func pushPolicyImage(t *testing.T, ref string, img v1.Image) {
+	t.Helper()
+	tag, err := name.NewTag(ref)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", ref, err)
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatalf("pushing %s: %v", ref, err)
+	}
+}
+
+func TestOCIProviderAgainstRegistry(t *testing.T) {
+	host := newTestRegistry(t)
+	repo := host + "/team/policies"
+	for _, tag := range []string{"v1.0.0", "v1.10.0", "v1.9.0", "latest", "sha-abc123"} {
+		pushPolicyImage(t, repo+":"+tag, newPolicyImage(t, testPolicyYAML))
+	}
+
+	config := &Config{Provider: "oci", ImageBase: repo, TagOrder: TagOrderSemver}
+	p, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+
+	latest, err := p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "v1.10.0" {
+		t.Errorf("LatestVersion() = %q, want %q", latest, "v1.10.0")
+	}
+
+	ref, err := p.Reference(latest)
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if want := repo + ":v1.10.0"; ref != want {
+		t.Errorf("Reference() = %q, want %q", ref, want)
+	}
+
+	destDir := filepath.Join(t.TempDir(), "image")
+	if err := pullImageToDirReal(context.Background(), config, latest, destDir); err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(destDir, "policy-0.yaml"))
+	if err != nil {
+		t.Fatalf("reading pulled policy: %v", err)
+	}
+	if !strings.Contains(string(data), "policy-version: v1.10.0") {
+		t.Errorf("pulled policy should carry the version label, got:\n%s", data)
+	}
+}
+
+// newPaginatedTagsServer serves a tags list split into pages linked with
+// Link headers, behind a bearer token challenge.
+func newPaginatedTagsServer(t *testing.T, pages [][]string) *httptest.Server {
+	t.Helper()
+	const token = "test-token"
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "robot" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/team/policies/tags/list":
+			page := 0
+			if last := r.URL.Query().Get("last"); last != "" {
+				for i, p := range pages {
+					if p[len(p)-1] == last {
+						page = i + 1
+					}
+				}
+			}
+			if page < len(pages)-1 {
+				w.Header().Set("Link", fmt.Sprintf(`</v2/team/policies/tags/list?n=%d&last=%s>; rel="next"`,
+					tagsPageSize, pages[page][len(pages[page])-1]))
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"name": "team/policies",
+				"tags": pages[page],
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return srv
+}
+
+func TestOCIProviderPaginationAndTokenAuth(t *testing.T) {
+	srv := newPaginatedTagsServer(t, [][]string{
+		{"v1.0.0", "v1.1.0"},
+		{"v2.0.0-rc.1", "latest"},
+		{"v1.2.0"},
+	})
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	config := &Config{
+		Provider:  "oci",
+		ImageBase: host + "/team/policies",
+		Username:  "robot",
+		Password:  "secret",
+		TagOrder:  TagOrderSemver,
+	}
+	p, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+
+	latest, err := p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "v2.0.0-rc.1" {
+		t.Errorf("LatestVersion() = %q, want %q", latest, "v2.0.0-rc.1")
+	}
+
+	config.TagExcludeRegex = `-rc\.`
+	latest, err = p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "v1.2.0" {
+		t.Errorf("LatestVersion() with TAG_EXCLUDE_REGEX = %q, want %q", latest, "v1.2.0")
+	}
+}
+
+func TestOCIProviderRejectsBadCredentials(t *testing.T) {
+	srv := newPaginatedTagsServer(t, [][]string{{"v1.0.0"}})
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	config := &Config{
+		Provider:  "oci",
+		ImageBase: host + "/team/policies",
+		Username:  "robot",
+		Password:  "wrong",
+	}
+	p, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+
+	if _, err := p.LatestVersion(context.Background()); err == nil {
+		t.Error("LatestVersion() error = nil, want authentication error")
+	}
+}
+
+func TestOCIProviderCredentialsOnlyForImageRegistry(t *testing.T) {
+	config := &Config{
+		Provider:  "oci",
+		ImageBase: "registry.example.com/team/policies",
+		Username:  "robot",
+		Password:  "secret",
+		Mirrors:   []string{"mirror.example.com"},
+	}
+	p, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+
+	got, err := p.Credentials(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Credentials() error = %v", err)
+	}
+	if want := (Credential{Username: "robot", Password: "secret"}); got != want {
+		t.Errorf("Credentials(registry) = %+v, want %+v", got, want)
+	}
+
+	got, err = p.Credentials(context.Background(), "mirror.example.com")
+	if err != nil {
+		t.Fatalf("Credentials() error = %v", err)
+	}
+	if got != (Credential{}) {
+		t.Errorf("Credentials(mirror) = %+v, want none", got)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeProvider is a Provider used to exercise the watch loop without a registry.
+type fakeProvider struct {
+	latest string
+	pulled []string
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) LatestVersion(ctx context.Context) (string, error) {
+	return p.latest, nil
+}
+
+func (p *fakeProvider) Reference(version string) (string, error) {
+	return "registry.example.com/fake:" + version, nil
+}
+
+func (p *fakeProvider) Credentials(ctx context.Context, registry string) (Credential, error) {
+	return Credential{}, nil
+}
+
+func (p *fakeProvider) Pull(ctx context.Context, ref, destDir string) error {
+	p.pulled = append(p.pulled, ref)
+	return os.WriteFile(filepath.Join(destDir, "policy.yaml"),
+		[]byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\n"), 0644)
+}
+
+func TestProviderNames(t *testing.T) {
+	got := providerNames()
+	want := []string{"artifactory", "git", "github", "layout", "oci"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("providerNames() = %v, want %v", got, want)
+	}
+}
+
+func TestLookupProviderUnknown(t *testing.T) {
+	_, err := lookupProvider("nope")
+	if err == nil {
+		t.Fatal("lookupProvider(\"nope\") error = nil, want error")
+	}
+	if !contains(err.Error(), "artifactory, git, github, layout, oci") {
+		t.Errorf("lookupProvider() error = %q, want to list supported providers", err.Error())
+	}
+}
+
+func TestProviderForCachesProvider(t *testing.T) {
+	config := &Config{Provider: "artifactory", ImageBase: "registry.example.com/repo/image:1.0.0"}
+
+	first, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+	second, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+
+	if first != second {
+		t.Error("providerFor() should return the same provider on subsequent calls")
+	}
+	if first.Name() != "artifactory" {
+		t.Errorf("Name() = %q, want %q", first.Name(), "artifactory")
+	}
+}
+
+func TestArtifactoryProvider(t *testing.T) {
+	config := &Config{
+		Provider:  "artifactory",
+		ImageBase: "registry.example.com/repo/image:1.2.3",
+		Username:  "user",
+		Password:  "secret",
+	}
+	p, err := providerFor(config)
+	if err != nil {
+		t.Fatalf("providerFor() error = %v", err)
+	}
+
+	latest, err := p.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion() error = %v", err)
+	}
+	if latest != "1.2.3" {
+		t.Errorf("LatestVersion() = %q, want %q", latest, "1.2.3")
+	}
+
+	ref, err := p.Reference(latest)
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if ref != config.ImageBase {
+		t.Errorf("Reference() = %q, want %q", ref, config.ImageBase)
+	}
+
+	cred, err := p.Credentials(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Credentials() error = %v", err)
+	}
+	if cred.Username != "user" || cred.Password != "secret" {
+		t.Errorf("Credentials() = %+v, want user/secret", cred)
+	}
+
+	if _, ok := p.(Puller); !ok {
+		t.Error("artifactory provider should implement Puller")
+	}
+}
+
+func TestGitHubProviderReference(t *testing.T) {
+	p := mustGitHubProvider(t, &Config{ImageBase: "ghcr.io/owner/policies"})
+
+	ref, err := p.Reference("v1.0.0")
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if ref != "ghcr.io/owner/policies:v1.0.0" {
+		t.Errorf("Reference() = %q, want %q", ref, "ghcr.io/owner/policies:v1.0.0")
+	}
+
+	ref, err = p.Reference("sha256:" + strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if want := "ghcr.io/owner/policies@sha256:" + strings.Repeat("ab", 32); ref != want {
+		t.Errorf("Reference() = %q, want %q", ref, want)
+	}
+
+	// A tag in IMAGE_BASE is replaced rather than appended to
+	tagged := mustGitHubProvider(t, &Config{ImageBase: "ghcr.io/owner/policies:v0.0.1"})
+	ref, err = tagged.Reference("v1.0.0")
+	if err != nil {
+		t.Fatalf("Reference() error = %v", err)
+	}
+	if ref != "ghcr.io/owner/policies:v1.0.0" {
+		t.Errorf("Reference() = %q, want %q", ref, "ghcr.io/owner/policies:v1.0.0")
+	}
+
+	cred, err := p.Credentials(context.Background(), "ghcr.io")
+	if err != nil {
+		t.Fatalf("Credentials() error = %v", err)
+	}
+	if !cred.Empty() {
+		t.Errorf("Credentials() = %+v, want empty credential", cred)
+	}
+
+	withToken := mustGitHubProvider(t, &Config{ImageBase: "ghcr.io/owner/policies", GithubToken: "ghp_test"})
+	cred, err = withToken.Credentials(context.Background(), "ghcr.io")
+	if err != nil {
+		t.Fatalf("Credentials() error = %v", err)
+	}
+	if cred.Password != "ghp_test" {
+		t.Errorf("Credentials() = %+v, want GITHUB_TOKEN", cred)
+	}
+	cred, err = withToken.Credentials(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Credentials() error = %v", err)
+	}
+	if !cred.Empty() {
+		t.Errorf("Credentials() = %+v for another registry, want empty credential", cred)
+	}
+}
+
+func TestPullImageToDirUsesProviderPuller(t *testing.T) {
+	fake := &fakeProvider{latest: "v1"}
+	config := &Config{Provider: "fake", provider: fake}
+	destDir := filepath.Join(t.TempDir(), "image")
+
+	if err := pullImageToDirReal(context.Background(), config, "v1", destDir); err != nil {
+		t.Fatalf("pullImageToDirReal() error = %v", err)
+	}
+
+	if want := []string{"registry.example.com/fake:v1"}; !reflect.DeepEqual(fake.pulled, want) {
+		t.Errorf("pulled = %v, want %v", fake.pulled, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(destDir, "policy.yaml"))
+	if err != nil {
+		t.Fatalf("reading pulled file: %v", err)
+	}
+	if !contains(string(data), "policy-version: v1") {
+		t.Errorf("pulled manifest should be labeled with the version, got:\n%s", data)
+	}
+}
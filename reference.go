@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// loadImageReference parses IMAGE_BASE of a registry provider into the
+// registry, repository, tag and digest stored in config.
+func loadImageReference(config *Config) error {
+	registry, repository, tag, digest, err := splitImageReference(config.ImageBase)
+	if err != nil {
+		return fmt.Errorf("failed to parse IMAGE_BASE: %v", err)
+	}
+
+	config.ImageRegistry = registry
+	config.ImageRepository = repository
+	config.ImageTag = tag
+	config.ImageDigest = digest
+	return nil
+}
+
+// splitImageReference splits an image reference such as
+// registry.local:5000/team/policies:v1@sha256:... into its parts. Registry
+// ports and nested repositories are supported. tag and digest are only set
+// when written in s, so the implicit "latest" is never reported.
+func splitImageReference(s string) (registry, repository, tag, digest string, err error) {
+	// name.ParseReference accepts tag+digest references but drops the tag
+	ref, err := name.ParseReference(s)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	if d, ok := ref.(name.Digest); ok {
+		digest = d.DigestStr()
+	}
+
+	base, _, _ := strings.Cut(s, "@")
+	lastElement := base[strings.LastIndex(base, "/")+1:]
+	if _, t, ok := strings.Cut(lastElement, ":"); ok {
+		tag = t
+	}
+
+	return ref.Context().RegistryStr(), ref.Context().RepositoryStr(), tag, digest, nil
+}
+
+// imageRepository returns the repository of IMAGE_BASE, marked insecure
+// when its registry is listed in INSECURE_REGISTRIES.
+func imageRepository(config *Config) (name.Repository, error) {
+	if config.ImageRepository == "" {
+		if err := loadImageReference(config); err != nil {
+			return name.Repository{}, err
+		}
+	}
+
+	var opts []name.Option
+	if isInsecureRegistry(config, config.ImageRegistry) {
+		opts = append(opts, name.Insecure)
+	}
+	return name.NewRepository(config.ImageRegistry+"/"+config.ImageRepository, opts...)
+}
+
+// isImageRegistry reports whether registry is the registry of IMAGE_BASE,
+// the only one static credentials are presented to.
+func isImageRegistry(config *Config, registry string) bool {
+	repo, err := imageRepository(config)
+	return err == nil && repo.RegistryStr() == registry
+}
+
+// parseImageBase extracts the GHCR owner and package from IMAGE_BASE, e.g.
+// ghcr.io/owner/team/policies:v1 -> owner, team/policies.
+func parseImageBase(imageBase string) (owner, packageName string, err error) {
+	registry, repository, _, _, err := splitImageReference(imageBase)
+	if err != nil {
+		return "", "", fmt.Errorf("IMAGE_BASE must be in format ghcr.io/owner/package, got: %s: %v", imageBase, err)
+	}
+	// Reject references relying on the Docker Hub default registry
+	if !strings.HasPrefix(imageBase, registry+"/") {
+		return "", "", fmt.Errorf("IMAGE_BASE must be in format ghcr.io/owner/package, got: %s", imageBase)
+	}
+
+	owner, packageName, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || packageName == "" {
+		return "", "", fmt.Errorf("could not extract owner and package from IMAGE_BASE: %s", imageBase)
+	}
+
+	return owner, packageName, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name           string
+		imageBase      string
+		wantRegistry   string
+		wantRepository string
+		wantTag        string
+		wantDigest     string
+		wantErr        bool
+	}{
+		{
+			name:           "repository only",
+			imageBase:      "ghcr.io/owner/policies",
+			wantRegistry:   "ghcr.io",
+			wantRepository: "owner/policies",
+		},
+		{
+			name:           "registry port",
+			imageBase:      "registry.local:5000/team/policies",
+			wantRegistry:   "registry.local:5000",
+			wantRepository: "team/policies",
+		},
+		{
+			name:           "registry port and tag",
+			imageBase:      "registry.local:5000/team/nested/policies:v1.0.0",
+			wantRegistry:   "registry.local:5000",
+			wantRepository: "team/nested/policies",
+			wantTag:        "v1.0.0",
+		},
+		{
+			name:           "digest",
+			imageBase:      "registry.local:5000/team/policies@" + digest,
+			wantRegistry:   "registry.local:5000",
+			wantRepository: "team/policies",
+			wantDigest:     digest,
+		},
+		{
+			name:           "tag and digest",
+			imageBase:      "ghcr.io/owner/policies:v1@" + digest,
+			wantRegistry:   "ghcr.io",
+			wantRepository: "owner/policies",
+			wantTag:        "v1",
+			wantDigest:     digest,
+		},
+		{
+			name:           "implicit Docker Hub registry",
+			imageBase:      "policies:v1",
+			wantRegistry:   "index.docker.io",
+			wantRepository: "library/policies",
+			wantTag:        "v1",
+		},
+		{
+			name:      "unsupported digest algorithm",
+			imageBase: "ghcr.io/owner/policies@md5:abcd",
+			wantErr:   true,
+		},
+		{
+			name:      "uppercase repository",
+			imageBase: "ghcr.io/Owner/policies",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{ImageBase: tt.imageBase}
+			err := loadImageReference(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadImageReference(%q) error = %v, wantErr %v", tt.imageBase, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got := []string{config.ImageRegistry, config.ImageRepository, config.ImageTag, config.ImageDigest}
+			want := []string{tt.wantRegistry, tt.wantRepository, tt.wantTag, tt.wantDigest}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("loadImageReference(%q) = %q, want %q", tt.imageBase, got, want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestImageRepositoryInsecureRegistry(t *testing.T) {
+	config := &Config{
+		ImageBase:          "registry.local:5000/team/policies:v1",
+		InsecureRegistries: []string{"registry.local:5000"},
+	}
+
+	repo, err := imageRepository(config)
+	if err != nil {
+		t.Fatalf("imageRepository() error = %v", err)
+	}
+	if repo.Name() != "registry.local:5000/team/policies" {
+		t.Errorf("imageRepository() = %s, want registry.local:5000/team/policies", repo.Name())
+	}
+	if repo.Scheme() != "http" {
+		t.Errorf("imageRepository() scheme = %s, want http", repo.Scheme())
+	}
+}
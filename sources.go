@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// defaultSourceParallelism bounds how many sources are synced at once
+	defaultSourceParallelism = 4
+	// defaultSyncTimeout is the default SYNC_TIMEOUT in seconds
+	defaultSyncTimeout = 300
+)
+
+var (
+	// validSourceName restricts source names to what is safe in paths and logs
+	validSourceName = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?$`)
+	// envReference matches the ${VAR} references expanded in SOURCES_FILE
+	envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// sourcesFile is the format of SOURCES_FILE.
+//
+//	sources:
+//	  - name: baseline
+//	    env:
+//	      IMAGE_BASE: ghcr.io/acme/policies/baseline
+//	  - name: exceptions
+//	    env:
+//	      PROVIDER: oci
+//	      IMAGE_BASE: registry.example.com/team/exceptions
+//	      REGISTRY_PASSWORD: ${EXCEPTIONS_REGISTRY_PASSWORD}
+type sourcesFile struct {
+	Sources []sourceSpec `json:"sources"`
+}
+
+// sourceSpec configures one watched artifact with the same settings as the
+// environment variables of a single-source watcher. Settings not given fall
+// back to the process environment, and ${VAR} references are expanded from it.
+type sourceSpec struct {
+	Name string            `json:"name"`
+	Env  map[string]string `json:"env"`
+}
+
+// source is a watched artifact together with the channel that requests an
+// immediate sync of it.
+type source struct {
+	config   *Config
+	triggers chan struct{}
+}
+
+func newSource(config *Config) *source {
+	return &source{
+		config:   config,
+		triggers: make(chan struct{}, 1),
+	}
+}
+
+// loadSources returns the configured sources: one per entry of SOURCES_FILE,
+// or the single source described by the environment when it is not set.
+func loadSources() []*source {
+	path := getEnvFunc("SOURCES_FILE")
+	if path == "" {
+		return []*source{newSource(loadConfig())}
+	}
+
+	specs, err := readSourcesFile(path)
+	if err != nil {
+		logFatal(fatalMessage(err))
+	}
+
+	sources := make([]*source, 0, len(specs))
+	for _, spec := range specs {
+		config := withSourceEnv(spec.Env, func() *Config {
+			return loadSourceConfig(spec.Name)
+		})
+		sources = append(sources, newSource(config))
+	}
+
+	return sources
+}
+
+// readSourcesFile parses and validates SOURCES_FILE.
+func readSourcesFile(path string) ([]sourceSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SOURCES_FILE: %v", err)
+	}
+
+	var file sourcesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse SOURCES_FILE %s: %v", path, err)
+	}
+	if len(file.Sources) == 0 {
+		return nil, fmt.Errorf("SOURCES_FILE %s defines no sources", path)
+	}
+
+	seen := make(map[string]bool, len(file.Sources))
+	for i, spec := range file.Sources {
+		if !validSourceName.MatchString(spec.Name) {
+			return nil, fmt.Errorf("invalid source name %q at index %d (lowercase letters, digits, '.', '_' and '-')", spec.Name, i)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("duplicate source name %q", spec.Name)
+		}
+		seen[spec.Name] = true
+	}
+
+	return file.Sources, nil
+}
+
+// withSourceEnv runs load with getEnvFunc layering env over the process
+// environment. It must only be used during startup, before sources run.
+func withSourceEnv(env map[string]string, load func() *Config) *Config {
+	processEnv := getEnvFunc
+	getEnvFunc = func(key string) string {
+		if value, ok := env[key]; ok {
+			return expandEnvReferences(value, processEnv)
+		}
+		return processEnv(key)
+	}
+	defer func() {
+		getEnvFunc = processEnv
+	}()
+
+	return load()
+}
+
+// expandEnvReferences replaces the ${VAR} references in value. Unlike
+// os.Expand it leaves a bare $ alone, so literal secrets and regular
+// expressions such as "pa$word" or "^v1$" are kept as written.
+func expandEnvReferences(value string, getenv func(string) string) string {
+	return envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		return getenv(envReference.FindStringSubmatch(ref)[1])
+	})
+}
+
+// sourceParallelism reads SOURCES_PARALLELISM.
+func sourceParallelism() int {
+	n := getEnvAsIntOrDefault("SOURCES_PARALLELISM", defaultSourceParallelism)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// runSources polls every source in its own goroutine, so a slow or failing
+// registry only delays its own source. At most parallelism syncs run at once.
+// runSources returns when stop is closed and all in-flight syncs finished.
+func runSources(sources []*source, parallelism int, stop <-chan struct{}) {
+	slots := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case slots <- struct{}{}:
+				case <-stop:
+					return
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), src.config.syncTimeout())
+				err := watchLoop(ctx, src.config)
+				cancel()
+				<-slots
+				if err != nil {
+					log.Printf("Error in watch loop%s: %v\n", src.config.logSuffix(), err)
+				}
+
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				waitForNextSync(src.config, src.triggers, stop)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// syncTimeout returns SYNC_TIMEOUT, falling back to the default when unset
+// or not positive.
+func (c *Config) syncTimeout() time.Duration {
+	if c.SyncTimeout < 1 {
+		return defaultSyncTimeout * time.Second
+	}
+	return time.Duration(c.SyncTimeout) * time.Second
+}
+
+// logSuffix names the source in log messages when several are watched.
+func (c *Config) logSuffix() string {
+	if c.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (source %s)", c.Name)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeTestSourcesFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sources.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestExpandEnvReferences(t *testing.T) {
+	env := map[string]string{"PASSWORD": "from-env", "word": "oops"}
+	getenv := func(key string) string {
+		return env[key]
+	}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "${PASSWORD}", want: "from-env"},
+		{value: "prefix-${PASSWORD}-suffix", want: "prefix-from-env-suffix"},
+		{value: "${UNSET}", want: ""},
+		{value: "pa$word", want: "pa$word"},
+		{value: "^v1\\.[0-9]+$", want: "^v1\\.[0-9]+$"},
+		{value: "$", want: "$"},
+		{value: "${not-a-name}", want: "${not-a-name}"},
+	}
+	for _, tt := range tests {
+		if got := expandEnvReferences(tt.value, getenv); got != tt.want {
+			t.Errorf("expandEnvReferences(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSources(t *testing.T) {
+	originalStateDirBase := stateDirBase
+	stateDirBase = t.TempDir()
+	defer func() {
+		stateDirBase = originalStateDirBase
+	}()
+
+	path := writeTestSourcesFile(t, `sources:
+  - name: baseline
+    env:
+      IMAGE_BASE: ghcr.io/acme/baseline
+  - name: exceptions
+    env:
+      PROVIDER: oci
+      IMAGE_BASE: registry.example.com/team/exceptions
+      REGISTRY_USERNAME: robot
+      REGISTRY_PASSWORD: ${EXCEPTIONS_PASSWORD}
+      TAG_EXCLUDE_REGEX: ^pr-$word
+`)
+
+	env := map[string]string{
+		"SOURCES_FILE":        path,
+		"GITHUB_TOKEN":        "ghp_shared",
+		"EXCEPTIONS_PASSWORD": "from-env",
+		"POLL_INTERVAL":       "60",
+	}
+	originalGetEnvFunc := getEnvFunc
+	getEnvFunc = func(key string) string {
+		return env[key]
+	}
+	defer func() {
+		getEnvFunc = originalGetEnvFunc
+	}()
+
+	sources := loadSources()
+	if len(sources) != 2 {
+		t.Fatalf("loadSources() returned %d sources, want 2", len(sources))
+	}
+
+	baseline, exceptions := sources[0].config, sources[1].config
+	if baseline.Name != "baseline" || baseline.Provider != "github" || baseline.GithubToken != "ghp_shared" {
+		t.Errorf("baseline = %+v, want github source using the process GITHUB_TOKEN", baseline)
+	}
+	if want := filepath.Join(stateDirBase, "baseline", "last_seen"); baseline.LastFile != want {
+		t.Errorf("baseline LastFile = %q, want %q", baseline.LastFile, want)
+	}
+	if exceptions.Provider != "oci" || exceptions.Password != "from-env" || exceptions.TagExcludeRegex != "^pr-$word" {
+		t.Errorf("exceptions = %+v, want oci source with expanded password and its own filters", exceptions)
+	}
+	if exceptions.TagIncludeRegex != "" || baseline.TagExcludeRegex != "" {
+		t.Error("filters leaked between sources")
+	}
+	if baseline.PollInterval != 60 || exceptions.PollInterval != 60 {
+		t.Errorf("PollInterval = %d/%d, want 60 from the process environment", baseline.PollInterval, exceptions.PollInterval)
+	}
+	if _, err := os.Stat(filepath.Join(stateDirBase, "exceptions")); err != nil {
+		t.Errorf("state directory of exceptions not created: %v", err)
+	}
+	if getEnvFunc("IMAGE_BASE") != "" {
+		t.Error("getEnvFunc was not restored after loading sources")
+	}
+}
+
+func TestReadSourcesFileErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		errContains string
+	}{
+		{
+			name:        "no sources",
+			content:     "sources: []\n",
+			errContains: "defines no sources",
+		},
+		{
+			name:        "invalid name",
+			content:     "sources:\n  - name: Team A\n",
+			errContains: "invalid source name",
+		},
+		{
+			name:        "duplicate name",
+			content:     "sources:\n  - name: a\n  - name: a\n",
+			errContains: "duplicate source name",
+		},
+		{
+			name:        "unknown field",
+			content:     "sources:\n  - name: a\n    image: ghcr.io/acme/a\n",
+			errContains: "failed to parse SOURCES_FILE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readSourcesFile(writeTestSourcesFile(t, tt.content))
+			if err == nil || !contains(err.Error(), tt.errContains) {
+				t.Errorf("readSourcesFile() error = %v, want to contain %q", err, tt.errContains)
+			}
+		})
+	}
+}
+
+// stubProvider is a fakeProvider whose LatestVersion is supplied by the test.
+type stubProvider struct {
+	fakeProvider
+	latestFunc func(ctx context.Context) (string, error)
+}
+
+func (p *stubProvider) LatestVersion(ctx context.Context) (string, error) {
+	return p.latestFunc(ctx)
+}
+
+func TestRunSourcesIsolatesFailures(t *testing.T) {
+	originalResolveDigestFunc := resolveDigestFunc
+	resolveDigestFunc = func(ctx context.Context, config *Config, imageRef string) (string, bool, error) {
+		return "", false, nil
+	}
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(ctx context.Context, config *Config, tag, destDir string) error {
+		return nil
+	}
+	originalApplyManifestsFunc := applyManifestsFunc
+	applyManifestsFunc = func(config *Config, dir string) error {
+		return nil
+	}
+	defer func() {
+		resolveDigestFunc = originalResolveDigestFunc
+		pullImageToDirFunc = originalPullImageToDirFunc
+		applyManifestsFunc = originalApplyManifestsFunc
+	}()
+
+	release := make(chan struct{})
+	var healthyPolls atomic.Int32
+	newTestSource := func(name string, pollInterval int, latest func(ctx context.Context) (string, error)) *source {
+		stateDir := t.TempDir()
+		return newSource(&Config{
+			Name:         name,
+			PollInterval: pollInterval,
+			StateDir:     stateDir,
+			LastFile:     filepath.Join(stateDir, "last_seen"),
+			provider:     &stubProvider{latestFunc: latest},
+		})
+	}
+	sources := []*source{
+		newTestSource("hanging", 0, func(ctx context.Context) (string, error) {
+			<-release
+			return "", nil
+		}),
+		newTestSource("failing", 1, func(ctx context.Context) (string, error) {
+			return "", errors.New("registry unavailable")
+		}),
+		newTestSource("healthy", 0, func(ctx context.Context) (string, error) {
+			healthyPolls.Add(1)
+			return "v1.0.0", nil
+		}),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runSources(sources, 2, stop)
+		close(done)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for healthyPolls.Load() < 3 {
+		select {
+		case <-deadline:
+			t.Fatalf("healthy source polled %d times, want it to keep polling while others hang or fail", healthyPolls.Load())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	state, err := readState(sources[2].config.LastFile)
+	if err != nil || state.Tag != "v1.0.0" {
+		t.Errorf("healthy source state = %+v, %v, want v1.0.0", state, err)
+	}
+
+	close(stop)
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runSources() did not return after stop")
+	}
+}
+
+func TestRunSourcesTimesOutHungSyncs(t *testing.T) {
+	originalResolveDigestFunc := resolveDigestFunc
+	resolveDigestFunc = func(ctx context.Context, config *Config, imageRef string) (string, bool, error) {
+		return "", false, nil
+	}
+	originalPullImageToDirFunc := pullImageToDirFunc
+	pullImageToDirFunc = func(ctx context.Context, config *Config, tag, destDir string) error {
+		return nil
+	}
+	originalApplyManifestsFunc := applyManifestsFunc
+	applyManifestsFunc = func(config *Config, dir string) error {
+		return nil
+	}
+	defer func() {
+		resolveDigestFunc = originalResolveDigestFunc
+		pullImageToDirFunc = originalPullImageToDirFunc
+		applyManifestsFunc = originalApplyManifestsFunc
+	}()
+
+	var timedOut, healthyPolls atomic.Int32
+	newTestSource := func(name string, pollInterval int, latest func(ctx context.Context) (string, error)) *source {
+		stateDir := t.TempDir()
+		return newSource(&Config{
+			Name:         name,
+			PollInterval: pollInterval,
+			SyncTimeout:  1,
+			StateDir:     stateDir,
+			LastFile:     filepath.Join(stateDir, "last_seen"),
+			provider:     &stubProvider{latestFunc: latest},
+		})
+	}
+	// Hung registries only return once the sync deadline cancels the request
+	hung := func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			timedOut.Add(1)
+		}
+		return "", ctx.Err()
+	}
+	sources := []*source{
+		newTestSource("hung-a", 60, hung),
+		newTestSource("hung-b", 60, hung),
+		newTestSource("healthy", 0, func(ctx context.Context) (string, error) {
+			healthyPolls.Add(1)
+			return "v1.0.0", nil
+		}),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		runSources(sources, 1, stop)
+		close(done)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for healthyPolls.Load() < 1 || timedOut.Load() < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("healthy source polled %d times and %d hung syncs timed out, want hung syncs to release their slot", healthyPolls.Load(), timedOut.Load())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runSources() did not return after stop")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// State is the last applied version, persisted in Config.LastFile.
+type State struct {
+	// Tag is the version returned by the provider
+	Tag string `json:"tag"`
+	// Digest is the manifest digest Tag resolved to when it was applied
+	Digest string `json:"digest,omitempty"`
+}
+
+// String formats the state for logs.
+func (s State) String() string {
+	if s.Digest == "" {
+		return s.Tag
+	}
+	return fmt.Sprintf("%s@%s", s.Tag, s.Digest)
+}
+
+// Changed reports whether latest differs from the previously applied state.
+// A digest that could not be resolved is ignored so that registry hiccups do
+// not cause re-applies, but a previous state without a digest is treated as
+// changed so the digest gets recorded.
+func (s State) Changed(latest State) bool {
+	if latest.Tag != s.Tag {
+		return true
+	}
+	return latest.Digest != "" && latest.Digest != s.Digest
+}
+
+// readState reads the state file. A missing file yields an empty state, and
+// files written by older versions (containing only the tag) are accepted.
+func readState(path string) (State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("reading state file: %w", err)
+	}
+
+	content := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(content, "{") {
+		return State{Tag: content}, nil
+	}
+
+	var state State
+	if err := json.Unmarshal([]byte(content), &state); err != nil {
+		return State{}, fmt.Errorf("parsing state file: %w", err)
+	}
+
+	return state, nil
+}
+
+// writeState persists state to path.
+func writeState(path string, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshaling state: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadState(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		create  bool
+		want    State
+		wantErr bool
+	}{
+		{
+			name:   "missing file",
+			create: false,
+			want:   State{},
+		},
+		{
+			name:    "legacy plain tag",
+			content: "v1.2.3\n",
+			create:  true,
+			want:    State{Tag: "v1.2.3"},
+		},
+		{
+			name:    "tag and digest",
+			content: `{"tag":"v1.2.3","digest":"sha256:abc"}`,
+			create:  true,
+			want:    State{Tag: "v1.2.3", Digest: "sha256:abc"},
+		},
+		{
+			name:    "corrupt json",
+			content: `{"tag":`,
+			create:  true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "last_seen")
+			if tt.create {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := readState(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readState() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last_seen")
+	want := State{Tag: "latest", Digest: "sha256:def"}
+
+	if err := writeState(path, want); err != nil {
+		t.Fatalf("writeState() error = %v", err)
+	}
+	got, err := readState(path)
+	if err != nil {
+		t.Fatalf("readState() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("readState() = %+v, want %+v", got, want)
+	}
+}
+
+func TestStateChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		prev   State
+		latest State
+		want   bool
+	}{
+		{name: "first run", prev: State{}, latest: State{Tag: "v1", Digest: "sha256:a"}, want: true},
+		{name: "same tag and digest", prev: State{Tag: "v1", Digest: "sha256:a"}, latest: State{Tag: "v1", Digest: "sha256:a"}, want: false},
+		{name: "new tag", prev: State{Tag: "v1", Digest: "sha256:a"}, latest: State{Tag: "v2", Digest: "sha256:a"}, want: true},
+		{name: "re-pushed tag", prev: State{Tag: "latest", Digest: "sha256:a"}, latest: State{Tag: "latest", Digest: "sha256:b"}, want: true},
+		{name: "unresolved digest", prev: State{Tag: "v1", Digest: "sha256:a"}, latest: State{Tag: "v1"}, want: false},
+		{name: "legacy state gains digest", prev: State{Tag: "v1"}, latest: State{Tag: "v1", Digest: "sha256:a"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.prev.Changed(tt.latest); got != tt.want {
+				t.Errorf("Changed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
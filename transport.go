@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// loadTransportConfig reads the TLS, insecure registry and proxy settings
+// applied to every outbound HTTP client, and builds the shared transport
+// when any of them differs from the defaults.
+func loadTransportConfig(config *Config) error {
+	config.TLSCAFiles = splitList(getEnvFunc("TLS_CA_FILE"))
+	config.TLSClientCertFile = strings.TrimSpace(getEnvFunc("TLS_CLIENT_CERT_FILE"))
+	config.TLSClientKeyFile = strings.TrimSpace(getEnvFunc("TLS_CLIENT_KEY_FILE"))
+	config.InsecureRegistries = splitList(getEnvFunc("INSECURE_REGISTRIES"))
+	config.HTTPProxy = proxyEnv("HTTP_PROXY")
+	config.HTTPSProxy = proxyEnv("HTTPS_PROXY")
+	config.NoProxy = proxyEnv("NO_PROXY")
+
+	if (config.TLSClientCertFile == "") != (config.TLSClientKeyFile == "") {
+		return fmt.Errorf("TLS_CLIENT_CERT_FILE and TLS_CLIENT_KEY_FILE must be set together")
+	}
+	for _, registry := range config.InsecureRegistries {
+		log.Printf("Using plain HTTP for registry %s\n", registry)
+	}
+
+	if len(config.TLSCAFiles) == 0 && config.TLSClientCertFile == "" &&
+		config.HTTPProxy == "" && config.HTTPSProxy == "" && config.NoProxy == "" {
+		return nil
+	}
+
+	transport, err := newTransport(config)
+	if err != nil {
+		return err
+	}
+	config.transport = transport
+
+	return nil
+}
+
+// newTransport returns a clone of http.DefaultTransport trusting the
+// system roots plus TLS_CA_FILE, presenting the client certificate and
+// routing through the configured proxies.
+func newTransport(config *Config) (*http.Transport, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(config.TLSCAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range config.TLSCAFiles {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read TLS_CA_FILE %s: %v", file, err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("TLS_CA_FILE %s contains no PEM certificates", file)
+			}
+			log.Printf("Trusting CA certificates from %s\n", file)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.TLSClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSClientCertFile, config.TLSClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		log.Printf("Using TLS client certificate %s\n", config.TLSClientCertFile)
+	}
+
+	proxy, err := proxyFunc(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+
+	return transport, nil
+}
+
+// httpTransport returns the transport shared by every outbound client of
+// config, falling back to http.DefaultTransport.
+func httpTransport(config *Config) http.RoundTripper {
+	if config.transport != nil {
+		return config.transport
+	}
+	return http.DefaultTransport
+}
+
+// proxyFunc selects HTTP_PROXY or HTTPS_PROXY by request scheme unless the
+// host is excluded by NO_PROXY. Loopback addresses are never proxied.
+func proxyFunc(config *Config) (func(*http.Request) (*url.URL, error), error) {
+	proxies := map[string]*url.URL{}
+	for scheme, raw := range map[string]string{"http": config.HTTPProxy, "https": config.HTTPSProxy} {
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s_PROXY: %s", strings.ToUpper(scheme), raw)
+		}
+		proxies[scheme] = u
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		proxy := proxies[req.URL.Scheme]
+		if proxy == nil || !useProxy(config, req.URL.Host) {
+			return nil, nil
+		}
+		return proxy, nil
+	}, nil
+}
+
+// useProxy reports whether requests to host (optionally with a port) go
+// through the proxy according to NO_PROXY.
+func useProxy(config *Config, host string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" {
+		return false
+	}
+	if ip := net.ParseIP(hostname); ip != nil && ip.IsLoopback() {
+		return false
+	}
+
+	for _, entry := range splitList(config.NoProxy) {
+		if entry == "*" {
+			return false
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip := net.ParseIP(hostname); ip != nil && cidr.Contains(ip) {
+				return false
+			}
+			continue
+		}
+		if strings.Contains(entry, ":") && entry == host {
+			return false
+		}
+		domain := strings.TrimPrefix(entry, ".")
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isInsecureRegistry reports whether registry is listed in
+// INSECURE_REGISTRIES and is accessed over plain HTTP.
+func isInsecureRegistry(config *Config, registry string) bool {
+	for _, insecure := range config.InsecureRegistries {
+		if insecure == registry {
+			return true
+		}
+	}
+	return false
+}
+
+// parseReference parses an image reference, marking registries listed in
+// INSECURE_REGISTRIES so go-containerregistry talks plain HTTP to them.
+func parseReference(config *Config, s string) (name.Reference, error) {
+	ref, err := name.ParseReference(s)
+	if err != nil || !isInsecureRegistry(config, ref.Context().RegistryStr()) {
+		return ref, err
+	}
+	return name.ParseReference(s, name.Insecure)
+}
+
+// proxyEnv returns the upper or lower case form of a proxy variable.
+func proxyEnv(key string) string {
+	if value := strings.TrimSpace(getEnvFunc(key)); value != "" {
+		return value
+	}
+	return strings.TrimSpace(getEnvFunc(strings.ToLower(key)))
+}
+
+// splitList splits a comma separated setting, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
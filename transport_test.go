@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestClientCert creates a CA and a client certificate signed by it,
+// returning the CA pool and the paths of the client certificate and key.
+func writeTestClientCert(t *testing.T) (*x509.CertPool, string, string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "watcher"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientDER}), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC " + "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return pool, certFile, keyFile
+}
+
+// writeTestServerCA writes the certificate of a TLS test server as a CA file.
+func writeTestServerCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func loadTestTransportConfig(t *testing.T, env map[string]string) (*Config, error) {
+	t.Helper()
+	originalGetEnvFunc := getEnvFunc
+	getEnvFunc = func(key string) string {
+		return env[key]
+	}
+	defer func() {
+		getEnvFunc = originalGetEnvFunc
+	}()
+
+	config := &Config{}
+	return config, loadTransportConfig(config)
+}
+
+func TestLoadTransportConfig(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantTransport bool
+		errContains   string
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{"INSECURE_REGISTRIES": "registry.lab:5000"},
+		},
+		{
+			name:          "proxy",
+			env:           map[string]string{"https_proxy": "http://proxy.example.com:3128"},
+			wantTransport: true,
+		},
+		{
+			name:        "client cert without key",
+			env:         map[string]string{"TLS_CLIENT_CERT_FILE": "/tmp/client.crt"},
+			errContains: "must be set together",
+		},
+		{
+			name:        "missing CA file",
+			env:         map[string]string{"TLS_CA_FILE": "/nonexistent/ca.crt"},
+			errContains: "failed to read TLS_CA_FILE",
+		},
+		{
+			name:        "CA file without certificates",
+			env:         map[string]string{"TLS_CA_FILE": notPEM},
+			errContains: "contains no PEM certificates",
+		},
+		{
+			name:        "invalid proxy",
+			env:         map[string]string{"HTTP_PROXY": "://proxy"},
+			errContains: "invalid HTTP_PROXY",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := loadTestTransportConfig(t, tt.env)
+			if tt.errContains != "" {
+				if err == nil || !contains(err.Error(), tt.errContains) {
+					t.Errorf("loadTransportConfig() error = %v, want to contain %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadTransportConfig() error = %v", err)
+			}
+			if (config.transport != nil) != tt.wantTransport {
+				t.Errorf("transport = %v, want custom transport %v", config.transport, tt.wantTransport)
+			}
+		})
+	}
+}
+
+func TestTransportCAAndClientCert(t *testing.T) {
+	clientCAs, certFile, keyFile := writeTestClientCert(t)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+	caFile := writeTestServerCA(t, srv)
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "system roots only",
+			env:     map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "CA without client certificate",
+			env:     map[string]string{"TLS_CA_FILE": caFile},
+			wantErr: true,
+		},
+		{
+			name: "CA and client certificate",
+			env:  map[string]string{"TLS_CA_FILE": caFile, "TLS_CLIENT_CERT_FILE": certFile, "TLS_CLIENT_KEY_FILE": keyFile},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := loadTestTransportConfig(t, tt.env)
+			if err != nil {
+				t.Fatalf("loadTransportConfig() error = %v", err)
+			}
+
+			client := &http.Client{Transport: httpTransport(config)}
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GET error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTransportProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	config, err := loadTestTransportConfig(t, map[string]string{
+		"HTTP_PROXY": proxy.URL,
+		"NO_PROXY":   "internal.example.com,10.0.0.0/8",
+	})
+	if err != nil {
+		t.Fatalf("loadTransportConfig() error = %v", err)
+	}
+
+	client := &http.Client{Transport: httpTransport(config)}
+	resp, err := client.Get("http://registry.example.com/v2/")
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if len(proxied) != 1 || proxied[0] != "http://registry.example.com/v2/" {
+		t.Errorf("proxied = %v, want the registry request", proxied)
+	}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "registry.example.com", want: true},
+		{host: "internal.example.com", want: false},
+		{host: "registry.internal.example.com:5000", want: false},
+		{host: "10.1.2.3:5000", want: false},
+		{host: "127.0.0.1:5000", want: false},
+		{host: "localhost", want: false},
+	}
+	for _, tt := range tests {
+		if got := useProxy(config, tt.host); got != tt.want {
+			t.Errorf("useProxy(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestParseReferenceInsecureRegistry(t *testing.T) {
+	config := &Config{InsecureRegistries: []string{"registry.lab:5000"}}
+
+	tests := []struct {
+		ref        string
+		wantScheme string
+	}{
+		{ref: "registry.lab:5000/team/policies:v1", wantScheme: "http"},
+		{ref: "registry.example.com/team/policies:v1", wantScheme: "https"},
+	}
+	for _, tt := range tests {
+		ref, err := parseReference(config, tt.ref)
+		if err != nil {
+			t.Fatalf("parseReference(%q) error = %v", tt.ref, err)
+		}
+		if got := ref.Context().Scheme(); got != tt.wantScheme {
+			t.Errorf("parseReference(%q) scheme = %q, want %q", tt.ref, got, tt.wantScheme)
+		}
+	}
+}
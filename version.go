@@ -0,0 +1,462 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tag orderings selectable via TAG_ORDER.
+const (
+	TagOrderSemver  = "semver"
+	TagOrderLexical = "lexical"
+	TagOrderNumeric = "numeric"
+)
+
+// semver is a parsed semantic version. A leading "v" is accepted.
+type semver struct {
+	Major, Minor, Patch int64
+	Prerelease          []string
+}
+
+// parseSemver parses tags of the form [v]MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD].
+func parseSemver(tag string) (semver, bool) {
+	s := strings.TrimPrefix(tag, "v")
+
+	// Build metadata does not participate in ordering
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+
+	var v semver
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		pre := s[i+1:]
+		s = s[:i]
+		if pre == "" {
+			return semver{}, false
+		}
+		v.Prerelease = strings.Split(pre, ".")
+		for _, id := range v.Prerelease {
+			if id == "" {
+				return semver{}, false
+			}
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+
+	nums := make([]int64, 3)
+	for i, p := range parts {
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || n < 0 || (len(p) > 1 && p[0] == '0') {
+			return semver{}, false
+		}
+		nums[i] = n
+	}
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+
+	return v, true
+}
+
+// compareSemver returns -1, 0 or 1 following semver 2.0.0 precedence rules.
+func compareSemver(a, b semver) int {
+	if c := cmp.Compare(a.Major, b.Major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Minor, b.Minor); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Patch, b.Patch); c != 0 {
+		return c
+	}
+
+	// A version without prerelease has higher precedence
+	switch {
+	case len(a.Prerelease) == 0 && len(b.Prerelease) == 0:
+		return 0
+	case len(a.Prerelease) == 0:
+		return 1
+	case len(b.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.Prerelease) && i < len(b.Prerelease); i++ {
+		if c := comparePrereleaseID(a.Prerelease[i], b.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(a.Prerelease), len(b.Prerelease))
+}
+
+func comparePrereleaseID(a, b string) int {
+	an, aErr := strconv.ParseInt(a, 10, 64)
+	bn, bErr := strconv.ParseInt(b, 10, 64)
+
+	switch {
+	case aErr == nil && bErr == nil:
+		return cmp.Compare(an, bn)
+	case aErr == nil:
+		// Numeric identifiers have lower precedence than alphanumeric ones
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// validTagOrder reports whether order is a supported TAG_ORDER value.
+func validTagOrder(order string) bool {
+	switch order {
+	case TagOrderSemver, TagOrderLexical, TagOrderNumeric:
+		return true
+	}
+	return false
+}
+
+// loadTagOrder reads TAG_ORDER from the environment.
+func loadTagOrder() (string, error) {
+	order := strings.ToLower(getEnvOrDefault("TAG_ORDER", TagOrderSemver))
+	if !validTagOrder(order) {
+		return "", fmt.Errorf("unsupported TAG_ORDER: %s (must be one of: %s, %s, %s)",
+			order, TagOrderSemver, TagOrderLexical, TagOrderNumeric)
+	}
+	return order, nil
+}
+
+// sortTags returns the tags that can be ordered under order, sorted from
+// oldest to newest. Tags that do not fit the ordering (e.g. "latest" under
+// semver) are dropped.
+func sortTags(tags []string, order string) ([]string, error) {
+	var sorted []string
+
+	switch order {
+	case TagOrderSemver:
+		parsed := map[string]semver{}
+		for _, tag := range tags {
+			if v, ok := parseSemver(tag); ok {
+				parsed[tag] = v
+				sorted = append(sorted, tag)
+			}
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if c := compareSemver(parsed[sorted[i]], parsed[sorted[j]]); c != 0 {
+				return c < 0
+			}
+			// Keep "v1.0.0" and "1.0.0" in a deterministic order
+			return sorted[i] < sorted[j]
+		})
+	case TagOrderNumeric:
+		parsed := map[string]uint64{}
+		for _, tag := range tags {
+			if n, err := strconv.ParseUint(tag, 10, 64); err == nil {
+				parsed[tag] = n
+				sorted = append(sorted, tag)
+			}
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if parsed[sorted[i]] != parsed[sorted[j]] {
+				return parsed[sorted[i]] < parsed[sorted[j]]
+			}
+			return sorted[i] < sorted[j]
+		})
+	case TagOrderLexical:
+		sorted = append(sorted, tags...)
+		sort.Strings(sorted)
+	default:
+		return nil, fmt.Errorf("unsupported tag order %q (must be one of: %s, %s, %s)",
+			order, TagOrderSemver, TagOrderLexical, TagOrderNumeric)
+	}
+
+	return sorted, nil
+}
+
+// newestTag returns the newest tag under order, or "" if none qualifies.
+func newestTag(tags []string, order string) (string, error) {
+	sorted, err := sortTags(tags, order)
+	if err != nil {
+		return "", err
+	}
+	if len(sorted) == 0 {
+		return "", nil
+	}
+	return sorted[len(sorted)-1], nil
+}
+
+// comparator is a single primitive version comparison such as ">=1.4.0".
+type comparator struct {
+	op string
+	v  semver
+	// explicitPrerelease is set when the user wrote a prerelease version
+	explicitPrerelease bool
+}
+
+func (c comparator) matches(v semver) bool {
+	cmp := compareSemver(v, c.v)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// versionConstraint is a parsed VERSION_CONSTRAINT. Comparators separated by
+// spaces or commas must all match; alternatives are separated by "||".
+//
+// Supported forms: "1.4.2", "=1.4.2", "!=1.4.2", ">1.4", ">=1.4", "<2",
+// "<=1.4", "~1.4" (>=1.4.0 <1.5.0), "^1.4" (>=1.4.0 <2.0.0) and wildcards
+// such as "1.4.x" or "*".
+type versionConstraint struct {
+	raw  string
+	sets [][]comparator
+}
+
+func (c *versionConstraint) String() string {
+	return c.raw
+}
+
+// partialVersion is a version with possibly omitted or wildcard components,
+// e.g. "1.4" or "1.x".
+type partialVersion struct {
+	nums       [3]int64
+	specified  int
+	prerelease []string
+}
+
+// lower returns the smallest version matching p.
+func (p partialVersion) lower() semver {
+	return semver{Major: p.nums[0], Minor: p.nums[1], Patch: p.nums[2], Prerelease: p.prerelease}
+}
+
+// bump returns the smallest version above every version that matches p in
+// its first n components, excluding the prereleases of that version.
+func (p partialVersion) bump(n int) semver {
+	v := semver{Prerelease: []string{"0"}}
+	switch n {
+	case 1:
+		v.Major = p.nums[0] + 1
+	case 2:
+		v.Major, v.Minor = p.nums[0], p.nums[1]+1
+	default:
+		v.Major, v.Minor, v.Patch = p.nums[0], p.nums[1], p.nums[2]+1
+	}
+	return v
+}
+
+func parsePartialVersion(s string) (partialVersion, error) {
+	var p partialVersion
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		if s[i+1:] == "" {
+			return p, fmt.Errorf("empty prerelease in %q", s)
+		}
+		p.prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return p, fmt.Errorf("too many version components in %q", s)
+	}
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid version component %q", part)
+		}
+		p.nums[i] = n
+		p.specified = i + 1
+	}
+
+	if p.prerelease != nil && p.specified != 3 {
+		return p, fmt.Errorf("prerelease requires a full version in %q", s)
+	}
+
+	return p, nil
+}
+
+// expandComparator turns one constraint term into primitive comparators.
+func expandComparator(term string) ([]comparator, error) {
+	comps, prerelease, err := expandTerm(term)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comps {
+		comps[i].explicitPrerelease = prerelease
+	}
+	return comps, nil
+}
+
+// expandTerm expands a single term and reports whether it names a prerelease.
+func expandTerm(term string) ([]comparator, bool, error) {
+	version := strings.TrimLeft(term, "<>=!~^")
+	op := term[:len(term)-len(version)]
+	p, err := parsePartialVersion(version)
+	if err != nil {
+		return nil, false, err
+	}
+	full := p.specified == 3
+	pre := p.prerelease != nil
+
+	switch op {
+	case "", "=", "==":
+		if full {
+			return []comparator{{op: "=", v: p.lower()}}, pre, nil
+		}
+		if p.specified == 0 {
+			return nil, pre, nil
+		}
+		return []comparator{{op: ">=", v: p.lower()}, {op: "<", v: p.bump(p.specified)}}, pre, nil
+	case "!=":
+		if !full {
+			return nil, false, fmt.Errorf("%q: != requires a full version", term)
+		}
+		return []comparator{{op: "!=", v: p.lower()}}, pre, nil
+	case ">":
+		if full {
+			return []comparator{{op: ">", v: p.lower()}}, pre, nil
+		}
+		if p.specified == 0 {
+			return nil, false, fmt.Errorf("%q: nothing is greater than *", term)
+		}
+		return []comparator{{op: ">=", v: p.bump(p.specified)}}, pre, nil
+	case ">=":
+		return []comparator{{op: ">=", v: p.lower()}}, pre, nil
+	case "<":
+		return []comparator{{op: "<", v: p.lower()}}, pre, nil
+	case "<=":
+		if full {
+			return []comparator{{op: "<=", v: p.lower()}}, pre, nil
+		}
+		if p.specified == 0 {
+			return nil, pre, nil
+		}
+		return []comparator{{op: "<", v: p.bump(p.specified)}}, pre, nil
+	case "~", "~>":
+		if p.specified == 0 {
+			return nil, pre, nil
+		}
+		n := 2
+		if p.specified == 1 {
+			n = 1
+		}
+		return []comparator{{op: ">=", v: p.lower()}, {op: "<", v: p.bump(n)}}, pre, nil
+	case "^":
+		if p.specified == 0 {
+			return nil, pre, nil
+		}
+		// Bump the left-most non-zero specified component
+		var n int
+		switch {
+		case p.nums[0] != 0 || p.specified == 1:
+			n = 1
+		case p.nums[1] != 0 || p.specified == 2:
+			n = 2
+		default:
+			n = 3
+		}
+		return []comparator{{op: ">=", v: p.lower()}, {op: "<", v: p.bump(n)}}, pre, nil
+	}
+
+	return nil, false, fmt.Errorf("%q: unknown operator %q", term, op)
+}
+
+// parseConstraint parses a VERSION_CONSTRAINT expression.
+func parseConstraint(s string) (*versionConstraint, error) {
+	c := &versionConstraint{raw: strings.TrimSpace(s)}
+	if c.raw == "" {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+
+	for _, alt := range strings.Split(c.raw, "||") {
+		// Allow whitespace between an operator and its version, e.g. ">= 1.0"
+		var terms []string
+		pendingOp := ""
+		for _, field := range strings.FieldsFunc(alt, func(r rune) bool { return r == ' ' || r == ',' }) {
+			if strings.Trim(field, "<>=!~^") == "" {
+				pendingOp += field
+				continue
+			}
+			terms = append(terms, pendingOp+field)
+			pendingOp = ""
+		}
+		if pendingOp != "" {
+			return nil, fmt.Errorf("invalid version constraint %q: operator %q without version", c.raw, pendingOp)
+		}
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("invalid version constraint %q: empty alternative", c.raw)
+		}
+
+		set := []comparator{}
+		for _, term := range terms {
+			comps, err := expandComparator(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint %q: %w", c.raw, err)
+			}
+			set = append(set, comps...)
+		}
+		c.sets = append(c.sets, set)
+	}
+
+	return c, nil
+}
+
+// Check reports whether v satisfies the constraint. Prerelease versions only
+// match when includePrerelease is set or when a comparator of the matching
+// alternative names a prerelease of the same MAJOR.MINOR.PATCH, so "~1.4"
+// does not pick up "1.4.3-rc.1" but ">=1.4.3-rc.0" does.
+func (c *versionConstraint) Check(v semver, includePrerelease bool) bool {
+	for _, set := range c.sets {
+		matches := true
+		prereleaseAllowed := includePrerelease || len(v.Prerelease) == 0
+		for _, comp := range set {
+			if !comp.matches(v) {
+				matches = false
+				break
+			}
+			if comp.explicitPrerelease &&
+				comp.v.Major == v.Major && comp.v.Minor == v.Minor && comp.v.Patch == v.Patch {
+				prereleaseAllowed = true
+			}
+		}
+		if matches && prereleaseAllowed {
+			return true
+		}
+	}
+	return false
+}
+
+// preferredTag picks a deterministic tag among several tags of the same
+// version: the highest semver tag if there is one, otherwise the
+// lexically smallest tag.
+func preferredTag(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	if best, _ := newestTag(tags, TagOrderSemver); best != "" {
+		return best
+	}
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+	return sorted[0]
+}
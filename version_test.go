@@ -0,0 +1,300 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		input  string
+		wantOK bool
+		want   semver
+	}{
+		{input: "1.2.3", wantOK: true, want: semver{Major: 1, Minor: 2, Patch: 3}},
+		{input: "v1.2.3", wantOK: true, want: semver{Major: 1, Minor: 2, Patch: 3}},
+		{input: "v1.2.3-rc.1", wantOK: true, want: semver{Major: 1, Minor: 2, Patch: 3, Prerelease: []string{"rc", "1"}}},
+		{input: "1.2.3+build.5", wantOK: true, want: semver{Major: 1, Minor: 2, Patch: 3}},
+		{input: "1.2", wantOK: false},
+		{input: "01.2.3", wantOK: false},
+		{input: "1.2.3-", wantOK: false},
+		{input: "latest", wantOK: false},
+		{input: "sha-abc123", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := parseSemver(tt.input)
+			if ok != tt.wantOK {
+				t.Fatalf("parseSemver(%q) ok = %v, want %v", tt.input, ok, tt.wantOK)
+			}
+			if ok && compareSemver(got, tt.want) != 0 {
+				t.Errorf("parseSemver(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	// Ordered from lowest to highest precedence, per the semver 2.0.0 spec
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"2.0.0",
+		"10.0.0",
+	}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		a, _ := parseSemver(ordered[i])
+		b, _ := parseSemver(ordered[i+1])
+		if compareSemver(a, b) >= 0 {
+			t.Errorf("compareSemver(%s, %s) should be < 0", ordered[i], ordered[i+1])
+		}
+		if compareSemver(b, a) <= 0 {
+			t.Errorf("compareSemver(%s, %s) should be > 0", ordered[i+1], ordered[i])
+		}
+	}
+}
+
+func TestNewestTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		order   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "semver ignores non-semver tags",
+			tags:  []string{"latest", "v1.9.0", "v1.10.0", "sha-abc", "v1.2.0"},
+			order: TagOrderSemver,
+			want:  "v1.10.0",
+		},
+		{
+			name:  "semver release beats prerelease",
+			tags:  []string{"v2.0.0-rc.1", "v2.0.0", "v1.0.0"},
+			order: TagOrderSemver,
+			want:  "v2.0.0",
+		},
+		{
+			name:  "semver with no matching tags",
+			tags:  []string{"latest", "main"},
+			order: TagOrderSemver,
+			want:  "",
+		},
+		{
+			name:  "lexical",
+			tags:  []string{"2024-01-02", "2024-10-01", "2024-09-30"},
+			order: TagOrderLexical,
+			want:  "2024-10-01",
+		},
+		{
+			name:  "numeric",
+			tags:  []string{"9", "10", "latest", "2"},
+			order: TagOrderNumeric,
+			want:  "10",
+		},
+		{
+			name:    "unsupported order",
+			tags:    []string{"v1.0.0"},
+			order:   "random",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newestTag(tt.tags, tt.order)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newestTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("newestTag() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		includePre bool
+		matches    []string
+		rejects    []string
+	}{
+		{
+			constraint: "~1.4",
+			matches:    []string{"1.4.0", "v1.4.9"},
+			rejects:    []string{"1.3.9", "1.5.0", "1.4.3-rc.1", "1.5.0-rc.1", "2.0.0"},
+		},
+		{
+			constraint: "~1.4.2",
+			matches:    []string{"1.4.2", "1.4.10"},
+			rejects:    []string{"1.4.1", "1.5.0"},
+		},
+		{
+			constraint: "~1",
+			matches:    []string{"1.0.0", "1.9.9"},
+			rejects:    []string{"0.9.0", "2.0.0"},
+		},
+		{
+			constraint: ">=2.0.0 <3.0.0",
+			matches:    []string{"2.0.0", "2.99.1"},
+			rejects:    []string{"1.9.9", "3.0.0", "3.0.0-rc.1", "2.1.0-beta.1"},
+		},
+		{
+			constraint: ">= 2.0.0, < 3.0.0",
+			matches:    []string{"2.5.0"},
+			rejects:    []string{"3.0.0"},
+		},
+		{
+			constraint: "^1.4",
+			matches:    []string{"1.4.0", "1.99.0"},
+			rejects:    []string{"1.3.0", "2.0.0"},
+		},
+		{
+			constraint: "^0.4.2",
+			matches:    []string{"0.4.2", "0.4.9"},
+			rejects:    []string{"0.5.0", "0.4.1"},
+		},
+		{
+			constraint: "^0.0.3",
+			matches:    []string{"0.0.3"},
+			rejects:    []string{"0.0.4"},
+		},
+		{
+			constraint: "1.4.x",
+			matches:    []string{"1.4.0", "1.4.7"},
+			rejects:    []string{"1.5.0"},
+		},
+		{
+			constraint: "1.2.3",
+			matches:    []string{"1.2.3", "v1.2.3"},
+			rejects:    []string{"1.2.4"},
+		},
+		{
+			constraint: "<=1.4",
+			matches:    []string{"1.4.9", "0.1.0"},
+			rejects:    []string{"1.5.0"},
+		},
+		{
+			constraint: ">1.4",
+			matches:    []string{"1.5.0"},
+			rejects:    []string{"1.4.9"},
+		},
+		{
+			constraint: "!=1.4.1 ~1.4",
+			matches:    []string{"1.4.0", "1.4.2"},
+			rejects:    []string{"1.4.1"},
+		},
+		{
+			constraint: "~1.4 || >=3.0.0",
+			matches:    []string{"1.4.1", "3.2.0"},
+			rejects:    []string{"2.0.0"},
+		},
+		{
+			constraint: "*",
+			matches:    []string{"0.0.1", "9.9.9"},
+			rejects:    []string{"1.0.0-rc.1"},
+		},
+		{
+			constraint: ">=1.4.3-rc.0 <1.5.0",
+			matches:    []string{"1.4.3-rc.1", "1.4.3", "1.4.4"},
+			rejects:    []string{"1.4.4-rc.1"},
+		},
+		{
+			constraint: "~1.4",
+			includePre: true,
+			matches:    []string{"1.4.3-rc.1", "1.4.0"},
+			rejects:    []string{"1.5.0-rc.1", "1.4.0-rc.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := parseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("parseConstraint(%q) error = %v", tt.constraint, err)
+			}
+			for _, tag := range tt.matches {
+				v, ok := parseSemver(tag)
+				if !ok {
+					t.Fatalf("bad test tag %q", tag)
+				}
+				if !c.Check(v, tt.includePre) {
+					t.Errorf("%q should match %q", tt.constraint, tag)
+				}
+			}
+			for _, tag := range tt.rejects {
+				v, ok := parseSemver(tag)
+				if !ok {
+					t.Fatalf("bad test tag %q", tag)
+				}
+				if c.Check(v, tt.includePre) {
+					t.Errorf("%q should not match %q", tt.constraint, tag)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, input := range []string{"", ">=", "~1.x.2.3", "!=1.4", "abc", ">=1.0.0 ||", "=>1.0.0"} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := parseConstraint(input); err == nil {
+				t.Errorf("parseConstraint(%q) error = nil, want error", input)
+			}
+		})
+	}
+}
+
+func TestFilterCandidateTagsByConstraint(t *testing.T) {
+	config := &Config{VersionConstraint: "~1.4"}
+	tags := []string{"latest", "v1.3.0", "v1.4.0", "v1.4.2", "v1.4.3-rc.1", "v1.5.0"}
+
+	got, err := filterCandidateTags(config, tags)
+	if err != nil {
+		t.Fatalf("filterCandidateTags() error = %v", err)
+	}
+	want := []string{"v1.4.0", "v1.4.2"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("filterCandidateTags() = %v, want %v", got, want)
+	}
+
+	unfiltered, err := filterCandidateTags(&Config{}, tags)
+	if err != nil {
+		t.Fatalf("filterCandidateTags() error = %v", err)
+	}
+	if len(unfiltered) != len(tags) {
+		t.Errorf("filterCandidateTags() without constraint = %v, want all tags", unfiltered)
+	}
+}
+
+func TestPreferredTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{name: "highest semver wins over latest", tags: []string{"latest", "v1.2.0", "v1.10.0"}, want: "v1.10.0"},
+		{name: "order independent", tags: []string{"v1.10.0", "v1.2.0", "latest"}, want: "v1.10.0"},
+		{name: "no semver tags", tags: []string{"main", "latest", "edge"}, want: "edge"},
+		{name: "single", tags: []string{"sha-abc"}, want: "sha-abc"},
+		{name: "empty", tags: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := preferredTag(tt.tags); got != tt.want {
+				t.Errorf("preferredTag(%v) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// webhookPath is where registry notifications are accepted
+	webhookPath = "/webhook"
+	// webhookPollInterval is the default POLL_INTERVAL when webhooks are
+	// enabled; polling then only acts as a safety net
+	webhookPollInterval = 300
+	// maxWebhookBodySize bounds the accepted notification payload
+	maxWebhookBodySize = 5 << 20
+)
+
+// loadWebhookConfig reads WEBHOOK_ADDR and WEBHOOK_SECRET. With webhooks
+// enabled POLL_INTERVAL defaults to webhookPollInterval.
+func loadWebhookConfig(config *Config) error {
+	addr := strings.TrimSpace(getEnvFunc("WEBHOOK_ADDR"))
+	if addr == "" {
+		return nil
+	}
+
+	secret := getEnvFunc("WEBHOOK_SECRET")
+	if secret == "" {
+		return errors.New("WEBHOOK_SECRET must be set when WEBHOOK_ADDR is set")
+	}
+
+	config.WebhookAddr = addr
+	config.WebhookSecret = secret
+	if getEnvFunc("POLL_INTERVAL") == "" {
+		config.PollInterval = webhookPollInterval
+	}
+
+	return nil
+}
+
+// webhookHandler accepts push notifications from GitHub, Harbor, Artifactory
+// and CNCF Distribution registries and requests a sync of every source whose
+// repository was pushed to.
+type webhookHandler struct {
+	secret  string
+	targets []webhookTarget
+}
+
+// webhookTarget maps the lower-cased repository path of a source's
+// IMAGE_BASE to the source.
+type webhookTarget struct {
+	repository string
+	source     *source
+}
+
+func newWebhookHandler(secret string, sources []*source) (*webhookHandler, error) {
+	h := &webhookHandler{secret: secret}
+	for _, src := range sources {
+		// Only registry sources receive push notifications
+		if src.config.Provider == "layout" || src.config.Provider == "git" {
+			continue
+		}
+		repo, err := imageRepository(src.config)
+		if err != nil {
+			return nil, fmt.Errorf("parsing IMAGE_BASE%s: %w", src.config.logSuffix(), err)
+		}
+		h.targets = append(h.targets, webhookTarget{
+			repository: strings.ToLower(repo.RepositoryStr()),
+			source:     src,
+		})
+	}
+
+	return h, nil
+}
+
+// serveWebhooks listens on addr until the server fails.
+func serveWebhooks(addr, secret string, sources []*source) error {
+	handler, err := newWebhookHandler(secret, sources)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(webhookPath, handler)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("Listening for registry webhooks on %s%s\n", addr, webhookPath)
+	return server.ListenAndServe()
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if !verifyWebhook(r.Header, body, h.secret) {
+		log.Printf("Warning: rejected webhook from %s: invalid signature\n", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	sender, repos, err := parseWebhook(r.Header, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	matched := false
+	for _, target := range h.targets {
+		if !slices.ContainsFunc(repos, func(repo string) bool { return strings.ToLower(repo) == target.repository }) {
+			continue
+		}
+
+		log.Printf("Received %s webhook for %s, triggering sync%s\n", sender, target.repository, target.source.config.logSuffix())
+		// A pending trigger already covers this push
+		select {
+		case target.source.triggers <- struct{}{}:
+		default:
+		}
+		matched = true
+	}
+
+	if matched {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, "ignored\n")
+}
+
+// verifyWebhook checks the HMAC-SHA256 signature sent by GitHub
+// (X-Hub-Signature-256), Artifactory (X-JFrog-Event-Auth) or any sender
+// using X-Signature-256. Harbor and CNCF Distribution cannot sign payloads,
+// so for them the secret is expected verbatim in the Authorization header.
+func verifyWebhook(h http.Header, body []byte, secret string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	for _, header := range []string{"X-Hub-Signature-256", "X-Signature-256", "X-JFrog-Event-Auth"} {
+		value := h.Get(header)
+		if value == "" {
+			continue
+		}
+		signature, err := hex.DecodeString(strings.TrimPrefix(value, "sha256="))
+		if err == nil && hmac.Equal(signature, expected) {
+			return true
+		}
+		// Artifactory sends the plain secret token unless payload signing is enabled
+		return header == "X-JFrog-Event-Auth" && secretEqual(value, secret)
+	}
+
+	auth := strings.TrimSpace(h.Get("Authorization"))
+	if auth == "" {
+		return false
+	}
+	return secretEqual(strings.TrimPrefix(auth, "Bearer "), secret)
+}
+
+func secretEqual(got, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(secret)) == 1
+}
+
+// webhookPayload is the union of the notification formats that are
+// understood; only the fields identifying pushed repositories are decoded.
+type webhookPayload struct {
+	// GitHub package and registry_package events
+	Action          string                `json:"action"`
+	Package         *githubWebhookPackage `json:"package"`
+	RegistryPackage *githubWebhookPackage `json:"registry_package"`
+
+	// Harbor
+	Type      string `json:"type"`
+	EventData *struct {
+		Repository struct {
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+
+	// Artifactory
+	Domain    string `json:"domain"`
+	EventType string `json:"event_type"`
+	Data      *struct {
+		RepoKey   string `json:"repo_key"`
+		ImageName string `json:"image_name"`
+	} `json:"data"`
+
+	// CNCF Distribution
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+		} `json:"target"`
+	} `json:"events"`
+}
+
+type githubWebhookPackage struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace"`
+	PackageType string `json:"package_type"`
+	Owner       struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+// parseWebhook detects the sender of a notification and returns the
+// repository paths it reports as pushed. Events other than pushes yield no
+// repositories.
+func parseWebhook(h http.Header, body []byte) (sender string, repos []string, err error) {
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	switch {
+	case h.Get("X-GitHub-Event") != "":
+		event := h.Get("X-GitHub-Event")
+		pkg := payload.Package
+		if event == "registry_package" {
+			pkg = payload.RegistryPackage
+		}
+		if (event != "package" && event != "registry_package") || pkg == nil {
+			return "github", nil, nil
+		}
+		if payload.Action != "published" && payload.Action != "updated" {
+			return "github", nil, nil
+		}
+		if !strings.EqualFold(pkg.PackageType, "container") {
+			return "github", nil, nil
+		}
+		owner := pkg.Namespace
+		if owner == "" {
+			owner = pkg.Owner.Login
+		}
+		return "github", []string{owner + "/" + pkg.Name}, nil
+
+	case payload.EventData != nil:
+		if payload.Type != "PUSH_ARTIFACT" {
+			return "harbor", nil, nil
+		}
+		return "harbor", []string{payload.EventData.Repository.RepoFullName}, nil
+
+	case payload.Data != nil && payload.Domain != "":
+		if payload.Domain != "docker" || payload.EventType != "pushed" {
+			return "artifactory", nil, nil
+		}
+		// IMAGE_BASE may or may not include the repository key, depending on
+		// the Artifactory Docker access method
+		data := payload.Data
+		return "artifactory", []string{data.RepoKey + "/" + data.ImageName, data.ImageName}, nil
+
+	case payload.Events != nil:
+		for _, event := range payload.Events {
+			if event.Action == "push" {
+				repos = append(repos, event.Target.Repository)
+			}
+		}
+		return "distribution", repos, nil
+	}
+
+	return "", nil, errors.New("unrecognized webhook payload")
+}
+
+// waitForNextSync blocks until the poll interval elapses, a webhook
+// triggers a sync or stop is closed.
+func waitForNextSync(config *Config, triggers <-chan struct{}, stop <-chan struct{}) {
+	timer := time.NewTimer(time.Duration(config.PollInterval) * time.Second)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-triggers:
+	case <-stop:
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "s3cret"
+
+func signTestWebhook(body string) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		imageBase   string
+		method      string
+		headers     map[string]string
+		body        string
+		wantStatus  int
+		wantTrigger bool
+	}{
+		{
+			name:      "github package published",
+			imageBase: "ghcr.io/owner/team/policies",
+			headers: map[string]string{
+				"X-GitHub-Event":      "package",
+				"X-Hub-Signature-256": "sha256=" + signTestWebhook(`{"action":"published","package":{"name":"team/policies","namespace":"owner","package_type":"CONTAINER"}}`),
+			},
+			body:        `{"action":"published","package":{"name":"team/policies","namespace":"owner","package_type":"CONTAINER"}}`,
+			wantStatus:  http.StatusAccepted,
+			wantTrigger: true,
+		},
+		{
+			name:      "github registry_package for another package",
+			imageBase: "ghcr.io/owner/policies",
+			headers: map[string]string{
+				"X-GitHub-Event":      "registry_package",
+				"X-Hub-Signature-256": "sha256=" + signTestWebhook(`{"action":"published","registry_package":{"name":"other","owner":{"login":"owner"},"package_type":"container"}}`),
+			},
+			body:       `{"action":"published","registry_package":{"name":"other","owner":{"login":"owner"},"package_type":"container"}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:      "github ping",
+			imageBase: "ghcr.io/owner/policies",
+			headers: map[string]string{
+				"X-GitHub-Event":      "ping",
+				"X-Hub-Signature-256": "sha256=" + signTestWebhook(`{"zen":"Keep it logically awesome."}`),
+			},
+			body:       `{"zen":"Keep it logically awesome."}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:      "invalid signature",
+			imageBase: "ghcr.io/owner/policies",
+			headers: map[string]string{
+				"X-GitHub-Event":      "package",
+				"X-Hub-Signature-256": "sha256=" + signTestWebhook("something else"),
+			},
+			body:       `{"action":"published","package":{"name":"policies","namespace":"owner","package_type":"container"}}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing signature",
+			imageBase:  "ghcr.io/owner/policies",
+			body:       `{"action":"published","package":{"name":"policies","namespace":"owner","package_type":"container"}}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "harbor push with authorization header",
+			imageBase: "harbor.example.com/library/policies",
+			headers: map[string]string{
+				"Authorization": testWebhookSecret,
+			},
+			body:        `{"type":"PUSH_ARTIFACT","event_data":{"repository":{"repo_full_name":"library/policies"}}}`,
+			wantStatus:  http.StatusAccepted,
+			wantTrigger: true,
+		},
+		{
+			name:      "harbor delete is ignored",
+			imageBase: "harbor.example.com/library/policies",
+			headers: map[string]string{
+				"Authorization": "Bearer " + testWebhookSecret,
+			},
+			body:       `{"type":"DELETE_ARTIFACT","event_data":{"repository":{"repo_full_name":"library/policies"}}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:      "artifactory signed payload",
+			imageBase: "registry.example.com/docker-local/policies",
+			headers: map[string]string{
+				"X-JFrog-Event-Auth": signTestWebhook(`{"domain":"docker","event_type":"pushed","data":{"repo_key":"docker-local","image_name":"policies","tag":"1.0.0"}}`),
+			},
+			body:        `{"domain":"docker","event_type":"pushed","data":{"repo_key":"docker-local","image_name":"policies","tag":"1.0.0"}}`,
+			wantStatus:  http.StatusAccepted,
+			wantTrigger: true,
+		},
+		{
+			name:      "artifactory secret token with subdomain access",
+			imageBase: "docker-local.example.com/policies",
+			headers: map[string]string{
+				"X-JFrog-Event-Auth": testWebhookSecret,
+			},
+			body:        `{"domain":"docker","event_type":"pushed","data":{"repo_key":"docker-local","image_name":"policies","tag":"1.0.0"}}`,
+			wantStatus:  http.StatusAccepted,
+			wantTrigger: true,
+		},
+		{
+			name:      "distribution notification",
+			imageBase: "registry.example.com/team/policies",
+			headers: map[string]string{
+				"Authorization": "Bearer " + testWebhookSecret,
+			},
+			body:        `{"events":[{"action":"pull","target":{"repository":"team/policies"}},{"action":"push","target":{"repository":"team/policies"}}]}`,
+			wantStatus:  http.StatusAccepted,
+			wantTrigger: true,
+		},
+		{
+			name:      "unrecognized payload",
+			imageBase: "registry.example.com/team/policies",
+			headers: map[string]string{
+				"Authorization": testWebhookSecret,
+			},
+			body:       `{"hello":"world"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "method not allowed",
+			imageBase:  "registry.example.com/team/policies",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newSource(&Config{ImageBase: tt.imageBase})
+			handler, err := newWebhookHandler(testWebhookSecret, []*source{src})
+			if err != nil {
+				t.Fatalf("newWebhookHandler() error = %v", err)
+			}
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, webhookPath, strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if triggered := len(src.triggers) == 1; triggered != tt.wantTrigger {
+				t.Errorf("triggered = %v, want %v", triggered, tt.wantTrigger)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerTriggersMatchingSource(t *testing.T) {
+	team := newSource(&Config{Name: "team", ImageBase: "registry.example.com/team/policies"})
+	other := newSource(&Config{Name: "other", ImageBase: "registry.example.com/team/exceptions"})
+	handler, err := newWebhookHandler(testWebhookSecret, []*source{team, other})
+	if err != nil {
+		t.Fatalf("newWebhookHandler() error = %v", err)
+	}
+
+	body := `{"events":[{"action":"push","target":{"repository":"team/policies"}}]}`
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, webhookPath, strings.NewReader(body))
+		req.Header.Set("X-Signature-256", "sha256="+signTestWebhook(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusAccepted)
+		}
+	}
+
+	if len(team.triggers) != 1 {
+		t.Errorf("pending triggers = %d, want 1", len(team.triggers))
+	}
+	if len(other.triggers) != 0 {
+		t.Errorf("other source triggered, want only the pushed repository")
+	}
+}
+
+func TestWaitForNextSync(t *testing.T) {
+	triggers := make(chan struct{}, 1)
+	triggers <- struct{}{}
+
+	done := make(chan struct{})
+	go func() {
+		waitForNextSync(&Config{PollInterval: 3600}, triggers, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waitForNextSync() did not return after a trigger")
+	}
+}
+
+func TestLoadWebhookConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		envVars          map[string]string
+		wantErr          bool
+		wantPollInterval int
+	}{
+		{
+			name:             "disabled",
+			envVars:          map[string]string{},
+			wantPollInterval: 30,
+		},
+		{
+			name:    "missing secret",
+			envVars: map[string]string{"WEBHOOK_ADDR": ":8080"},
+			wantErr: true,
+		},
+		{
+			name:             "enabled slows default polling",
+			envVars:          map[string]string{"WEBHOOK_ADDR": ":8080", "WEBHOOK_SECRET": testWebhookSecret},
+			wantPollInterval: webhookPollInterval,
+		},
+		{
+			name:             "explicit poll interval kept",
+			envVars:          map[string]string{"WEBHOOK_ADDR": ":8080", "WEBHOOK_SECRET": testWebhookSecret, "POLL_INTERVAL": "30"},
+			wantPollInterval: 30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalGetEnvFunc := getEnvFunc
+			getEnvFunc = func(key string) string {
+				return tt.envVars[key]
+			}
+			defer func() {
+				getEnvFunc = originalGetEnvFunc
+			}()
+
+			config := &Config{PollInterval: 30}
+			err := loadWebhookConfig(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadWebhookConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && config.PollInterval != tt.wantPollInterval {
+				t.Errorf("PollInterval = %d, want %d", config.PollInterval, tt.wantPollInterval)
+			}
+		})
+	}
+}